@@ -0,0 +1,135 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package safetensors
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// IsCanonical returns true if buffer is a valid safetensors file serialized
+// with SerializeOptions.Canonical.
+//
+// Only the header is compared since it fully determines the data layout.
+func IsCanonical(buffer []byte) bool {
+	f, err := Parse(buffer)
+	if err != nil {
+		return false
+	}
+	b, _, err := f.canonicalHeader()
+	return err == nil && bytes.HasPrefix(buffer, b)
+}
+
+// canonicalHeader returns the canonical header, including the length prefix,
+// and the order in which the tensors' data must be written.
+func (f *File) canonicalHeader() ([]byte, []int, error) {
+	if f.RawMetadata != nil {
+		return nil, nil, errors.New("canonical: RawMetadata is not supported")
+	}
+	order := make([]int, len(f.Tensors))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortFunc(order, func(a, b int) int {
+		return strings.Compare(f.Tensors[a].Name, f.Tensors[b].Name)
+	})
+	b := append(make([]byte, 8, 256), '{')
+	var err error
+	if len(f.Metadata) != 0 {
+		b = append(b, `"__metadata__":{`...)
+		for i, k := range slices.Sorted(maps.Keys(f.Metadata)) {
+			if i != 0 {
+				b = append(b, ',')
+			}
+			if b, err = appendCanonicalString(b, k); err != nil {
+				return nil, nil, err
+			}
+			b = append(b, ':')
+			if b, err = appendCanonicalString(b, f.Metadata[k]); err != nil {
+				return nil, nil, err
+			}
+		}
+		b = append(b, '}')
+	}
+	var offset uint64
+	for n, i := range order {
+		t := &f.Tensors[i]
+		if err := t.Validate(); err != nil {
+			return nil, nil, &TensorError{Name: t.Name, Index: i, Err: err}
+		}
+		if t.Extra != nil {
+			return nil, nil, &TensorError{Name: t.Name, Index: i, Err: errors.New("canonical: Extra is not supported")}
+		}
+		if t.Name == "__metadata__" || (n != 0 && t.Name == f.Tensors[order[n-1]].Name) {
+			return nil, nil, &TensorError{Name: t.Name, Index: i, Err: errorf(ErrDuplicateName, "duplicate tensor name")}
+		}
+		if len(b) > 9 {
+			b = append(b, ',')
+		}
+		if b, err = appendCanonicalString(b, t.Name); err != nil {
+			return nil, nil, &TensorError{Name: t.Name, Index: i, Err: err}
+		}
+		b = append(b, `:{"dtype":"`...)
+		b = append(b, t.DType...)
+		b = append(b, `","shape":[`...)
+		for j, v := range t.Shape {
+			if j != 0 {
+				b = append(b, ',')
+			}
+			b = strconv.AppendUint(b, v, 10)
+		}
+		b = append(b, `],"data_offsets":[`...)
+		b = strconv.AppendUint(b, offset, 10)
+		b = append(b, ',')
+		offset += uint64(len(t.Data))
+		b = strconv.AppendUint(b, offset, 10)
+		b = append(b, "]}"...)
+	}
+	b = append(b, '}')
+	for len(b)&7 != 0 {
+		b = append(b, ' ')
+	}
+	binary.LittleEndian.PutUint64(b, uint64(len(b)-8))
+	return b, order, nil
+}
+
+// appendCanonicalString appends s as a JSON string where only '"', '\' and
+// control characters are escaped.
+func appendCanonicalString(b []byte, s string) ([]byte, error) {
+	if !utf8.ValidString(s) {
+		return nil, errors.New("canonical: string is not valid UTF-8")
+	}
+	const hex = "0123456789abcdef"
+	b = append(b, '"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"', '\\':
+			b = append(b, '\\', c)
+		case '\b':
+			b = append(b, '\\', 'b')
+		case '\f':
+			b = append(b, '\\', 'f')
+		case '\n':
+			b = append(b, '\\', 'n')
+		case '\r':
+			b = append(b, '\\', 'r')
+		case '\t':
+			b = append(b, '\\', 't')
+		default:
+			if c < 0x20 {
+				b = append(b, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xF])
+			} else {
+				b = append(b, c)
+			}
+		}
+	}
+	return append(b, '"'), nil
+}
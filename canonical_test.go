@@ -0,0 +1,129 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package safetensors
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestSerialize_Canonical(t *testing.T) {
+	f := &File{
+		Metadata: map[string]string{"z": "<&>\n\x01é", "a": "b"},
+		Tensors: []Tensor{
+			{Name: "b", DType: U8, Shape: []uint64{1}, Data: []byte{2}},
+			{Name: "a", DType: U8, Shape: []uint64{2}, Data: []byte{0, 1}},
+		},
+	}
+	out := bytes.Buffer{}
+	if err := f.SerializeContext(context.Background(), &out, &SerializeOptions{Canonical: true}); err != nil {
+		t.Fatal(err)
+	}
+	hdr := `{"__metadata__":{"a":"b","z":"<&>\n\u0001é"},` +
+		`"a":{"dtype":"U8","shape":[2],"data_offsets":[0,2]},` +
+		`"b":{"dtype":"U8","shape":[1],"data_offsets":[2,3]}}`
+	for len(hdr)%8 != 0 {
+		hdr += " "
+	}
+	want := makeRaw(hdr, 0)
+	want = append(want, 0, 1, 2)
+	if !bytes.Equal(want, out.Bytes()) {
+		t.Fatalf("want:\n%q\ngot:\n%q", want, out.Bytes())
+	}
+	if !IsCanonical(out.Bytes()) {
+		t.Fatal("expected canonical")
+	}
+
+	// The default serialization keeps the tensors' order.
+	out.Reset()
+	if err := f.Serialize(&out); err != nil {
+		t.Fatal(err)
+	}
+	if IsCanonical(out.Bytes()) {
+		t.Fatal("expected not canonical")
+	}
+
+	// Round trip.
+	g, err := Parse(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := g.SerializeContext(context.Background(), &out, &SerializeOptions{Canonical: true}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(want, out.Bytes()) {
+		t.Fatal("round trip mismatch")
+	}
+}
+
+func TestSerialize_Canonical_Errors(t *testing.T) {
+	data := []struct {
+		name string
+		f    File
+		opts SerializeOptions
+	}{
+		{
+			"padding",
+			File{},
+			SerializeOptions{Canonical: true, HeaderPadding: 8},
+		},
+		{
+			"raw_metadata",
+			File{RawMetadata: []RawField{{Key: "a", Value: []byte(`1`)}}},
+			SerializeOptions{Canonical: true},
+		},
+		{
+			"extra",
+			File{Tensors: []Tensor{{Name: "a", DType: U8, Shape: []uint64{}, Data: []byte{0}, Extra: []RawField{{Key: "a", Value: []byte(`1`)}}}}},
+			SerializeOptions{Canonical: true},
+		},
+		{
+			"duplicate",
+			File{Tensors: []Tensor{{Name: "a", DType: U8, Shape: []uint64{}, Data: []byte{0}}, {Name: "a", DType: U8, Shape: []uint64{}, Data: []byte{0}}}},
+			SerializeOptions{Canonical: true},
+		},
+		{
+			"utf8",
+			File{Metadata: map[string]string{"a": "\xff"}},
+			SerializeOptions{Canonical: true},
+		},
+	}
+	for _, line := range data {
+		t.Run(line.name, func(t *testing.T) {
+			if err := line.f.SerializeContext(context.Background(), &bytes.Buffer{}, &line.opts); err == nil {
+				t.Fatal("expected error")
+			} else if line.name == "duplicate" && !errors.Is(err, ErrDuplicateName) {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestIsCanonical(t *testing.T) {
+	data := []string{
+		// Not sorted.
+		`{"b":{"dtype":"U8","shape":[],"data_offsets":[0,1]},"a":{"dtype":"U8","shape":[],"data_offsets":[1,2]}}`,
+		// Whitespace.
+		`{"a": {"dtype":"U8","shape":[],"data_offsets":[0,1]},"b":{"dtype":"U8","shape":[],"data_offsets":[1,2]}}`,
+		// Field order.
+		`{"a":{"shape":[],"dtype":"U8","data_offsets":[0,1]},"b":{"dtype":"U8","shape":[],"data_offsets":[1,2]}}`,
+		// Escaping.
+		`{"\u0061":{"dtype":"U8","shape":[],"data_offsets":[0,1]},"b":{"dtype":"U8","shape":[],"data_offsets":[1,2]}}`,
+	}
+	for i, hdr := range data {
+		for len(hdr)%8 != 0 {
+			hdr += " "
+		}
+		if IsCanonical(makeRaw(hdr, 2)) {
+			t.Errorf("#%d: expected not canonical", i)
+		}
+	}
+	if IsCanonical([]byte("garbage")) {
+		t.Fatal("expected not canonical")
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/maruel/safetensors"
+)
+
+func cmdCheck(args []string) error {
+	fl := flag.NewFlagSet("check", flag.ContinueOnError)
+	verbose := fl.Bool("v", false, "print the statistics of every tensor")
+	if err := fl.Parse(args); err != nil {
+		return err
+	}
+	if fl.NArg() == 0 {
+		return errors.New("usage: safetensors check [-v] <file>...")
+	}
+	bad := 0
+	for _, name := range fl.Args() {
+		n, err := checkFile(name, *verbose)
+		if err != nil {
+			return err
+		}
+		bad += n
+	}
+	if bad != 0 {
+		return fmt.Errorf("%d tensors with non-finite values", bad)
+	}
+	return nil
+}
+
+// checkFile prints the tensors with non-finite values and returns their
+// count.
+func checkFile(name string, verbose bool) (int, error) {
+	m := safetensors.Mapped{}
+	if err := m.Open(name); err != nil {
+		return 0, err
+	}
+	defer m.Close()
+	_ = m.Advise(safetensors.AdviceSequential)
+	stats, err := m.Stats(context.Background(), nil, 10)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", name, err)
+	}
+	bad := 0
+	for i, s := range stats {
+		if s == nil {
+			continue
+		}
+		t := &m.Tensors[i]
+		if !s.Finite() {
+			bad++
+			fmt.Printf("%s: %s: %d NaN, %d Inf out of %d\n", name, t.Name, s.NaN, s.Inf, s.Count)
+		}
+		if verbose {
+			fmt.Printf("%s: %s: %s%v min=%g max=%g mean=%g std=%g zero=%d hist=%v\n",
+				name, t.Name, t.DType, t.Shape, s.Min, s.Max, s.Mean, s.Std, s.Zero, s.Histogram)
+		}
+	}
+	return bad, nil
+}
@@ -0,0 +1,76 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"os"
+
+	"github.com/maruel/safetensors"
+)
+
+func cmdCompress(args []string) error {
+	fl := flag.NewFlagSet("compress", flag.ContinueOnError)
+	level := fl.Int("level", 3, "zstd compression level, 1 to 22")
+	shuffle := fl.Bool("shuffle", false, "shuffle the bytes by significance before compression")
+	if err := fl.Parse(args); err != nil {
+		return err
+	}
+	if fl.NArg() != 2 {
+		return errors.New("usage: safetensors compress [-level 3] [-shuffle] <in.safetensors> <out>")
+	}
+	in, err := os.Open(fl.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	return create(fl.Arg(1), func(f *os.File) error {
+		return safetensors.CompressFile(context.Background(), f, in, fi.Size(), &safetensors.CompressOptions{Level: *level, Shuffle: *shuffle})
+	})
+}
+
+func cmdDecompress(args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: safetensors decompress <in> <out.safetensors>")
+	}
+	in, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	c, err := safetensors.OpenCompressed(in, fi.Size(), &safetensors.ParseOptions{Lossless: true})
+	if err != nil {
+		return err
+	}
+	return create(args[1], func(f *os.File) error {
+		return c.Decompress(context.Background(), f)
+	})
+}
+
+// create creates the file name with fn and deletes it on failure.
+func create(name string, fn func(f *os.File) error) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	err = fn(f)
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		_ = os.Remove(name)
+	}
+	return err
+}
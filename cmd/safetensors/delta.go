@@ -0,0 +1,59 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/maruel/safetensors"
+)
+
+func cmdDelta(args []string) error {
+	const usage = "usage: safetensors delta create [-method xor|sub] <base> <target> <out> | apply <base> <delta> <out>"
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+	fl := flag.NewFlagSet("delta", flag.ContinueOnError)
+	method := fl.String("method", "xor", "delta encoding of the changed tensors: xor or sub")
+	if err := fl.Parse(args[1:]); err != nil {
+		return err
+	}
+	if fl.NArg() != 3 {
+		return errors.New(usage)
+	}
+	var base, other safetensors.Mapped
+	if err := base.Open(fl.Arg(0)); err != nil {
+		return err
+	}
+	defer base.Close()
+	if err := other.Open(fl.Arg(1)); err != nil {
+		return err
+	}
+	defer other.Close()
+	var out *safetensors.File
+	var err error
+	switch args[0] {
+	case "create":
+		m := safetensors.DeltaXOR
+		switch *method {
+		case "xor":
+		case "sub":
+			m = safetensors.DeltaSub
+		default:
+			return fmt.Errorf("unknown delta method %q", *method)
+		}
+		out, err = safetensors.Delta(base.File, other.File, m)
+	case "apply":
+		out, err = safetensors.ApplyDelta(base.File, other.File)
+	default:
+		return fmt.Errorf("unknown delta operation %q", args[0])
+	}
+	if err != nil {
+		return err
+	}
+	return safetensors.WriteFile(fl.Arg(2), out, nil)
+}
@@ -0,0 +1,61 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// safetensors is a tool to inspect and manipulate safetensors files.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands = map[string]command{
+	"check":      {"check [-v] <file>...", cmdCheck},
+	"compress":   {"compress [-level 3] [-shuffle] <in.safetensors> <out>", cmdCompress},
+	"decompress": {"decompress <in> <out.safetensors>", cmdDecompress},
+	"delta":      {"delta create [-method xor|sub] <base> <target> <out> | apply <base> <delta> <out>", cmdDelta},
+	"meta":       {"meta get|set|delete <file> [key[=value]...]", cmdMeta},
+	"serve":      {"serve [-addr :8080] <dir>", cmdServe},
+	"summary":    {"summary <file>", cmdSummary},
+}
+
+func usage() error {
+	names := make([]string, 0, len(commands))
+	for n := range commands {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	b.WriteString("usage: safetensors <command> ...\n\ncommands:\n")
+	for _, n := range names {
+		fmt.Fprintf(&b, "  %s\n", commands[n].usage)
+	}
+	return errors.New(strings.TrimSuffix(b.String(), "\n"))
+}
+
+func mainImpl() error {
+	if len(os.Args) < 2 {
+		return usage()
+	}
+	c, ok := commands[os.Args[1]]
+	if !ok {
+		return usage()
+	}
+	return c.run(os.Args[2:])
+}
+
+func main() {
+	if err := mainImpl(); err != nil {
+		fmt.Fprintf(os.Stderr, "safetensors: %s\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/maruel/safetensors"
+)
+
+func cmdMeta(args []string) error {
+	if len(args) < 2 {
+		return errors.New("usage: safetensors meta get|set|delete <file> [key[=value]...]")
+	}
+	op, name, keys := args[0], args[1], args[2:]
+	switch op {
+	case "get":
+		m := safetensors.Mapped{}
+		if err := m.Open(name); err != nil {
+			return err
+		}
+		defer m.Close()
+		if len(keys) == 0 {
+			keys = slices.Sorted(maps.Keys(m.Metadata))
+			for _, k := range keys {
+				fmt.Printf("%s=%s\n", k, m.Metadata[k])
+			}
+			return nil
+		}
+		for _, k := range keys {
+			v, ok := m.Metadata[k]
+			if !ok {
+				return fmt.Errorf("key %q not found", k)
+			}
+			fmt.Println(v)
+		}
+		return nil
+	case "set":
+		kv := map[string]string{}
+		for _, a := range keys {
+			k, v, ok := strings.Cut(a, "=")
+			if !ok {
+				return fmt.Errorf("expected key=value, got %q", a)
+			}
+			kv[k] = v
+		}
+		return safetensors.EditMetadata(name, func(m map[string]string) {
+			maps.Copy(m, kv)
+		})
+	case "delete":
+		return safetensors.EditMetadata(name, func(m map[string]string) {
+			for _, k := range keys {
+				delete(m, k)
+			}
+		})
+	default:
+		return fmt.Errorf("unknown meta operation %q", op)
+	}
+}
@@ -0,0 +1,30 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/maruel/safetensors"
+)
+
+func cmdServe(args []string) error {
+	fl := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := fl.String("addr", ":8080", "address to listen on")
+	if err := fl.Parse(args); err != nil {
+		return err
+	}
+	if fl.NArg() != 1 {
+		return errors.New("usage: safetensors serve [-addr :8080] <dir>")
+	}
+	s := safetensors.NewServer(fl.Arg(0))
+	defer s.Close()
+	fmt.Fprintf(os.Stderr, "serving %s on %s\n", fl.Arg(0), *addr)
+	return http.ListenAndServe(*addr, s)
+}
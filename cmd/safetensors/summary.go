@@ -0,0 +1,25 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/maruel/safetensors"
+)
+
+func cmdSummary(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: safetensors summary <file>")
+	}
+	m := safetensors.Mapped{}
+	if err := m.Open(args[0]); err != nil {
+		return err
+	}
+	defer m.Close()
+	fmt.Print(m.Summary())
+	return nil
+}
@@ -0,0 +1,450 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package safetensors
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// The compressed container is laid out as:
+//   - compressedMagic;
+//   - the safetensors header, including its length prefix, uncompressed;
+//   - one zstd frame per non-empty tensor, in data order;
+//   - the seek table: for each tensor in header order, the absolute offset
+//     and the size of its frame and its transform as little endian uint64.
+//     Version 1 files, with compressedMagicV1, have no transform field;
+//   - the footer: the absolute offset of the seek table as little endian
+//     uint64 followed by compressedMagic.
+//
+// Decompressing reproduces the safetensors header and data layout stored in
+// the container. See CompressFile to archive an existing file byte for byte.
+const compressedMagic = "STZSTD02"
+
+// compressedMagicV1 identifies the first version of the format, still
+// supported for reading.
+const compressedMagicV1 = "STZSTD01"
+
+// seekEntry is the size of a seek table entry.
+const seekEntry = 24
+
+// seekEntryV1 is the size of a seek table entry in version 1.
+const seekEntryV1 = 16
+
+// Transforms applied to a tensor's data before compression.
+const (
+	transformNone uint64 = iota
+	// transformShuffle is DType.Shuffle applied on each block of shuffleBlock
+	// bytes; the last block may be shorter.
+	transformShuffle
+)
+
+// CompressOptions controls SerializeCompressed and CompressFile.
+type CompressOptions struct {
+	SerializeOptions
+	// Level is the zstd compression level, between 1 and 22. Defaults to 3.
+	Level int
+	// Shuffle applies DType.Shuffle to the tensors with multi-byte elements
+	// before compression. It usually improves the ratio of floating point
+	// tensors at a small speed cost.
+	Shuffle bool
+}
+
+// SerializeCompressed writes f in the compressed container format, where each
+// tensor is compressed independently with zstd so it can be read on its own.
+//
+// The header and the data layout are the ones of SerializeContext with the
+// same options, which Compressed.Decompress reproduces. Use OpenCompressed to
+// read it back.
+func (f *File) SerializeCompressed(ctx context.Context, w io.Writer, opts *CompressOptions) error {
+	if opts == nil {
+		opts = &CompressOptions{}
+	}
+	if opts.HeaderPadding < 0 {
+		return fmt.Errorf("invalid header padding %d", opts.HeaderPadding)
+	}
+	level, err := opts.level()
+	if err != nil {
+		return err
+	}
+	if opts.Dedup {
+		if f, err = f.Dedup(); err != nil {
+			return err
+		}
+	}
+	b, order, err := f.encodeHeader(&opts.SerializeOptions)
+	if err != nil {
+		return err
+	}
+	srcs := make([]compressSource, len(f.Tensors))
+	for i := range f.Tensors {
+		t := &f.Tensors[i]
+		srcs[i] = compressSource{dtype: t.DType, size: uint64(len(t.Data)), r: bytes.NewReader(t.Data)}
+	}
+	return writeCompressed(ctx, w, b, srcs, order, level, opts)
+}
+
+// CompressFile writes the safetensors file of size bytes in r in the
+// compressed container format.
+//
+// Unlike SerializeCompressed, the header and the data layout are kept as is so
+// Compressed.Decompress reproduces the file byte for byte. Only
+// opts.Progress, opts.Level and opts.Shuffle are used.
+func CompressFile(ctx context.Context, w io.Writer, r io.ReaderAt, size int64, opts *CompressOptions) error {
+	if opts == nil {
+		opts = &CompressOptions{}
+	}
+	level, err := opts.level()
+	if err != nil {
+		return err
+	}
+	h := safeTensorsHeader{}
+	n, err := h.parseHeaderReader(io.NewSectionReader(r, 0, size), &ParseOptions{Lossless: true})
+	if err != nil {
+		return fmt.Errorf("invalid header: %w", err)
+	}
+	bufferEnd, err := h.validate()
+	if err != nil {
+		return fmt.Errorf("invalid metadata: %w", err)
+	}
+	if err := checkSize(n+8+bufferEnd, uint64(size)); err != nil {
+		return err
+	}
+	b := make([]byte, n+8)
+	if _, err := r.ReadAt(b, 0); err != nil {
+		return err
+	}
+	srcs := make([]compressSource, len(h.tensors))
+	order := make([]int, len(h.tensors))
+	for i := range h.tensors {
+		o := h.tensors[i].DataOffsets
+		srcs[i] = compressSource{dtype: h.tensors[i].DType, size: o[1] - o[0], r: io.NewSectionReader(r, int64(n+8+o[0]), int64(o[1]-o[0]))}
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return cmp.Compare(h.tensors[a].DataOffsets[0], h.tensors[b].DataOffsets[0])
+	})
+	return writeCompressed(ctx, w, b, srcs, order, level, opts)
+}
+
+func (o *CompressOptions) level() (int, error) {
+	level := o.Level
+	if level == 0 {
+		level = 3
+	}
+	if level < 1 || level > 22 {
+		return 0, fmt.Errorf("invalid compression level %d", level)
+	}
+	return level, nil
+}
+
+// compressSource is the data of a tensor to compress.
+type compressSource struct {
+	dtype DType
+	size  uint64
+	r     io.Reader
+}
+
+// writeCompressed writes the container with the encoded header hdr and the
+// tensors' data written in order.
+func writeCompressed(ctx context.Context, w io.Writer, hdr []byte, srcs []compressSource, order []int, level int, opts *CompressOptions) error {
+	enc, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)), zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		return err
+	}
+	cw := &countingWriter{w: w}
+	if _, err := io.WriteString(cw, compressedMagic); err != nil {
+		return err
+	}
+	if _, err := cw.Write(hdr); err != nil {
+		return err
+	}
+	total := uint64(len(hdr))
+	for i := range srcs {
+		total += srcs[i].size
+	}
+	p := progress{fn: opts.Progress, done: uint64(len(hdr)), total: total}
+	p.report()
+	seek := make([]byte, seekEntry*len(srcs))
+	buf := make([]byte, shuffleBlock)
+	var tmp []byte
+	for _, i := range order {
+		src := &srcs[i]
+		start := cw.n
+		transform := transformNone
+		if opts.Shuffle && src.dtype.WordSize() > 1 {
+			transform = transformShuffle
+			if tmp == nil {
+				tmp = make([]byte, shuffleBlock)
+			}
+		}
+		if src.size != 0 {
+			enc.Reset(cw)
+			for left := src.size; left != 0; {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				c := buf[:min(left, shuffleBlock)]
+				if _, err := io.ReadFull(src.r, c); err != nil {
+					return err
+				}
+				b := c
+				if transform == transformShuffle {
+					b = tmp[:len(c)]
+					if err := src.dtype.Shuffle(b, c); err != nil {
+						return err
+					}
+				}
+				if _, err := enc.Write(b); err != nil {
+					return err
+				}
+				left -= uint64(len(c))
+				p.add(len(c))
+			}
+			if err := enc.Close(); err != nil {
+				return err
+			}
+		}
+		binary.LittleEndian.PutUint64(seek[seekEntry*i:], start)
+		binary.LittleEndian.PutUint64(seek[seekEntry*i+8:], cw.n-start)
+		binary.LittleEndian.PutUint64(seek[seekEntry*i+16:], transform)
+	}
+	seek = binary.LittleEndian.AppendUint64(seek, cw.n)
+	seek = append(seek, compressedMagic...)
+	if _, err := cw.Write(seek); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// Compressed is a file in the compressed container format.
+//
+// Like Lazy, only the header is read upfront and Tensor.Data is nil until the
+// tensor is loaded with Load.
+type Compressed struct {
+	*File
+	r      io.ReaderAt
+	header []byte
+	// offsets are the uncompressed data offsets of each tensor.
+	offsets [][2]uint64
+	// frames are the absolute offset and size of each tensor's zstd frame.
+	frames [][2]uint64
+	// transforms are the transform applied on each tensor's data.
+	transforms []uint64
+}
+
+// OpenCompressed reads the header and the seek table of the compressed
+// container of size bytes in r.
+func OpenCompressed(r io.ReaderAt, size int64, opts *ParseOptions) (*Compressed, error) {
+	const fixed = int64(len(compressedMagic))
+	if size < 2*fixed+8+8 {
+		return nil, errorf(ErrTruncated, "compressed: too small (%d bytes)", size)
+	}
+	var footer [8 + len(compressedMagic)]byte
+	if _, err := r.ReadAt(footer[:], size-int64(len(footer))); err != nil {
+		return nil, errorf(ErrTruncated, "compressed: %w", err)
+	}
+	magic := make([]byte, len(compressedMagic))
+	if _, err := r.ReadAt(magic, 0); err != nil {
+		return nil, errorf(ErrTruncated, "compressed: %w", err)
+	}
+	entry := uint64(seekEntry)
+	switch {
+	case string(magic) != string(footer[8:]) || !bytes.HasPrefix(magic, []byte("STZSTD")):
+		return nil, errors.New("compressed: invalid magic")
+	case string(magic) == compressedMagicV1:
+		entry = seekEntryV1
+	case string(magic) != compressedMagic:
+		return nil, fmt.Errorf("compressed: unsupported version %q", magic)
+	}
+	h := safeTensorsHeader{}
+	sr := io.NewSectionReader(r, fixed, size-fixed)
+	n, err := h.parseHeaderReader(sr, opts)
+	if err != nil {
+		return nil, fmt.Errorf("invalid header: %w", err)
+	}
+	bufferEnd, err := h.validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid metadata: %w", err)
+	}
+	if err := opts.checkDataSize(bufferEnd); err != nil {
+		return nil, err
+	}
+	if bufferEnd > math.MaxInt {
+		return nil, errorf(ErrOverflow, "data too large: %d", bufferEnd)
+	}
+	dataStart := uint64(fixed) + 8 + n
+	seekStart := binary.LittleEndian.Uint64(footer[:])
+	if seekStart < dataStart || seekStart > uint64(size) || seekStart+entry*uint64(len(h.tensors)) != uint64(size)-uint64(len(footer)) {
+		return nil, errors.New("compressed: invalid seek table offset")
+	}
+	seek := make([]byte, entry*uint64(len(h.tensors)))
+	if _, err := r.ReadAt(seek, int64(seekStart)); err != nil {
+		return nil, errorf(ErrTruncated, "compressed: %w", err)
+	}
+	c := &Compressed{
+		File:       &File{Metadata: h.metadata, RawMetadata: h.rawMetadata, Tensors: make([]Tensor, len(h.tensors))},
+		r:          r,
+		header:     make([]byte, 8+n),
+		offsets:    make([][2]uint64, len(h.tensors)),
+		frames:     make([][2]uint64, len(h.tensors)),
+		transforms: make([]uint64, len(h.tensors)),
+	}
+	if _, err := r.ReadAt(c.header, fixed); err != nil {
+		return nil, errorf(ErrTruncated, "compressed: %w", err)
+	}
+	for i := range h.tensors {
+		h.tensors[i].toTensor(&c.Tensors[i], nil)
+		c.offsets[i] = h.tensors[i].DataOffsets
+		e := seek[entry*uint64(i):]
+		c.frames[i][0] = binary.LittleEndian.Uint64(e)
+		c.frames[i][1] = binary.LittleEndian.Uint64(e[8:])
+		if entry == seekEntry {
+			c.transforms[i] = binary.LittleEndian.Uint64(e[16:])
+		}
+		if c.frames[i][0] < dataStart || c.frames[i][0] > seekStart || c.frames[i][1] > seekStart-c.frames[i][0] || c.transforms[i] > transformShuffle {
+			return nil, &TensorError{Name: c.Tensors[i].Name, Index: i, Err: errors.New("compressed: invalid seek table entry")}
+		}
+	}
+	return c, nil
+}
+
+// Load decompresses the named tensors' data into Tensor.Data. When no name is
+// specified, all the tensors are loaded. Tensors already loaded are skipped.
+func (c *Compressed) Load(names ...string) error {
+	indexes, err := c.indexes(names)
+	if err != nil {
+		return err
+	}
+	dec, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return err
+	}
+	defer dec.Close()
+	for _, i := range indexes {
+		t := &c.Tensors[i]
+		if t.Data != nil {
+			continue
+		}
+		// Do not trust the offsets for the allocation, grow the buffer as data
+		// is decompressed.
+		a := appendWriter{b: []byte{}}
+		if err := c.decode(dec, i, &a); err != nil {
+			return &TensorError{Name: t.Name, Index: i, Err: err}
+		}
+		t.Data = a.b
+		if err := t.Validate(); err != nil {
+			t.Data = nil
+			return &TensorError{Name: t.Name, Index: i, Err: err}
+		}
+	}
+	return nil
+}
+
+// Decompress writes the original safetensors file to w.
+//
+// It doesn't require the tensors to be loaded.
+func (c *Compressed) Decompress(ctx context.Context, w io.Writer) error {
+	if _, err := w.Write(c.header); err != nil {
+		return err
+	}
+	order := make([]int, len(c.Tensors))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return cmp.Compare(c.offsets[a][0], c.offsets[b][0])
+	})
+	dec, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return err
+	}
+	defer dec.Close()
+	for _, i := range order {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := c.decode(dec, i, w); err != nil {
+			return &TensorError{Name: c.Tensors[i].Name, Index: i, Err: err}
+		}
+	}
+	return nil
+}
+
+// decode decompresses the frame of tensor i into w and verifies its size.
+func (c *Compressed) decode(dec *zstd.Decoder, i int, w io.Writer) error {
+	want := int64(c.offsets[i][1] - c.offsets[i][0])
+	if want == 0 {
+		return nil
+	}
+	if err := dec.Reset(io.NewSectionReader(c.r, int64(c.frames[i][0]), int64(c.frames[i][1]))); err != nil {
+		return err
+	}
+	var u *unshuffleWriter
+	if c.transforms[i] == transformShuffle {
+		u = &unshuffleWriter{w: w, dt: c.Tensors[i].DType}
+		w = u
+	}
+	// Limit the output to not be fooled by a frame larger than advertised.
+	n, err := io.Copy(w, io.LimitReader(dec, want+1))
+	if err != nil {
+		return err
+	}
+	if n != want {
+		return errorf(ErrShapeMismatch, "compressed: decompressed %d bytes, expected %d", n, want)
+	}
+	if u != nil {
+		return u.Flush()
+	}
+	return nil
+}
+
+func (c *Compressed) indexes(names []string) ([]int, error) {
+	var indexes []int
+	if len(names) == 0 {
+		for i := range c.Tensors {
+			indexes = append(indexes, i)
+		}
+		return indexes, nil
+	}
+	for _, name := range names {
+		i := slices.IndexFunc(c.Tensors, func(t Tensor) bool { return t.Name == name })
+		if i == -1 {
+			return nil, fmt.Errorf("tensor %q not found", name)
+		}
+		indexes = append(indexes, i)
+	}
+	return indexes, nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n uint64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += uint64(n)
+	return n, err
+}
+
+// appendWriter appends to a slice.
+type appendWriter struct {
+	b []byte
+}
+
+func (a *appendWriter) Write(p []byte) (int, error) {
+	a.b = append(a.b, p...)
+	return len(p), nil
+}
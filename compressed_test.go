@@ -0,0 +1,200 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package safetensors
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSerializeCompressed(t *testing.T) {
+	f := makeTestFile(20)
+	f.Metadata = map[string]string{"a": "b"}
+	f.Tensors = append(f.Tensors, Tensor{Name: "empty", DType: F32, Shape: []uint64{0}, Data: []byte{}})
+	f.Tensors = append(f.Tensors, Tensor{Name: "zeros", DType: BF16, Shape: []uint64{4096}, Data: make([]byte, 8192)})
+	ctx := context.Background()
+	opts := SerializeOptions{Order: OrderSize}
+	raw := bytes.Buffer{}
+	if err := f.SerializeContext(ctx, &raw, &opts); err != nil {
+		t.Fatal(err)
+	}
+	out := bytes.Buffer{}
+	if err := f.SerializeCompressed(ctx, &out, &CompressOptions{SerializeOptions: opts, Level: 19}); err != nil {
+		t.Fatal(err)
+	}
+	if out.Len() >= raw.Len() {
+		t.Fatalf("%d >= %d", out.Len(), raw.Len())
+	}
+	c, err := OpenCompressed(bytes.NewReader(out.Bytes()), int64(out.Len()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Tensors[3].Data != nil {
+		t.Fatal("expected lazy")
+	}
+	if err := c.Load("t3", "empty"); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(f.Tensors[3], c.Tensors[3]); diff != "" {
+		t.Fatalf("(-want,+got)\n%s", diff)
+	}
+	if c.Tensors[4].Data != nil {
+		t.Fatal("expected lazy")
+	}
+	if err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(f, c.File); diff != "" {
+		t.Fatalf("(-want,+got)\n%s", diff)
+	}
+	got := bytes.Buffer{}
+	if err := c.Decompress(ctx, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(raw.Bytes(), got.Bytes()) {
+		t.Fatal("decompressed file mismatch")
+	}
+	if err := c.Load("missing"); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestOpenCompressed_Errors(t *testing.T) {
+	f := makeTestFile(2)
+	out := bytes.Buffer{}
+	if err := f.SerializeCompressed(context.Background(), &out, nil); err != nil {
+		t.Fatal(err)
+	}
+	b := out.Bytes()
+	if _, err := OpenCompressed(bytes.NewReader(b[:10]), 10, nil); !errors.Is(err, ErrTruncated) {
+		t.Fatal(err)
+	}
+	bad := bytes.Clone(b)
+	bad[0] = 'X'
+	if _, err := OpenCompressed(bytes.NewReader(bad), int64(len(bad)), nil); err == nil {
+		t.Fatal("expected error")
+	}
+	// Truncating the data invalidates the seek table offset.
+	bad = append(bytes.Clone(b[:len(b)-60]), b[len(b)-48:]...)
+	if _, err := OpenCompressed(bytes.NewReader(bad), int64(len(bad)), nil); err == nil {
+		t.Fatal("expected error")
+	}
+	// Corrupt the first frame.
+	c, err := OpenCompressed(bytes.NewReader(b), int64(len(b)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad = bytes.Clone(b)
+	bad[c.frames[0][0]+c.frames[0][1]-1] ^= 0xFF
+	if c, err = OpenCompressed(bytes.NewReader(bad), int64(len(bad)), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Load("t0"); err == nil {
+		t.Fatal("expected error")
+	}
+	// A one byte frame for a tensor declaring a huge size.
+	hdr := makeRaw(`{"a":{"dtype":"U8","shape":[1125899906842624],"data_offsets":[0,1125899906842624]}}`, 0)
+	huge := bytes.Buffer{}
+	if err := writeCompressed(context.Background(), &huge, hdr, []compressSource{{dtype: U8, size: 1, r: bytes.NewReader([]byte{1})}}, []int{0}, 3, &CompressOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenCompressed(bytes.NewReader(huge.Bytes()), int64(huge.Len()), &ParseOptions{MaxDataSize: 1 << 20}); !errors.Is(err, ErrLimitExceeded) {
+		t.Fatal(err)
+	}
+	if c, err = OpenCompressed(bytes.NewReader(huge.Bytes()), int64(huge.Len()), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Load(); !errors.Is(err, ErrShapeMismatch) {
+		t.Fatal(err)
+	}
+	// A frame starting past the seek table.
+	bad = bytes.Clone(b)
+	seekStart := binary.LittleEndian.Uint64(b[len(b)-16:])
+	binary.LittleEndian.PutUint64(bad[seekStart:], 1<<63)
+	if _, err := OpenCompressed(bytes.NewReader(bad), int64(len(bad)), nil); err == nil {
+		t.Fatal("expected error")
+	}
+	if err := f.SerializeCompressed(context.Background(), &out, &CompressOptions{Level: 23}); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestCompressFile(t *testing.T) {
+	f := makeTestFile(20)
+	f.Tensors[5].Data = make([]byte, 8)
+	f.Tensors = append(f.Tensors, Tensor{Name: "empty", DType: F32, Shape: []uint64{0}, Data: []byte{}})
+	raw := bytes.Buffer{}
+	ctx := context.Background()
+	if err := f.SerializeContext(ctx, &raw, &SerializeOptions{HeaderPadding: 64, Order: OrderSize}); err != nil {
+		t.Fatal(err)
+	}
+	for _, shuffle := range []bool{false, true} {
+		out := bytes.Buffer{}
+		if err := CompressFile(ctx, &out, bytes.NewReader(raw.Bytes()), int64(raw.Len()), &CompressOptions{Shuffle: shuffle}); err != nil {
+			t.Fatal(err)
+		}
+		c, err := OpenCompressed(bytes.NewReader(out.Bytes()), int64(out.Len()), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := bytes.Buffer{}
+		if err := c.Decompress(ctx, &got); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(raw.Bytes(), got.Bytes()) {
+			t.Fatalf("%t: decompressed file mismatch", shuffle)
+		}
+		if err := c.Load(); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(f, c.File); diff != "" {
+			t.Fatalf("(-want,+got)\n%s", diff)
+		}
+	}
+	if err := CompressFile(ctx, &bytes.Buffer{}, bytes.NewReader(raw.Bytes()), int64(raw.Len()-1), nil); !errors.Is(err, ErrTruncated) {
+		t.Fatal(err)
+	}
+}
+
+func TestOpenCompressed_V1(t *testing.T) {
+	f := makeTestFile(3)
+	out := bytes.Buffer{}
+	if err := f.SerializeCompressed(context.Background(), &out, nil); err != nil {
+		t.Fatal(err)
+	}
+	// Convert to version 1 by dropping the transform field of each entry.
+	b := out.Bytes()
+	seekStart := binary.LittleEndian.Uint64(b[len(b)-16:])
+	v1 := append([]byte(compressedMagicV1), b[8:seekStart]...)
+	for i := range f.Tensors {
+		e := b[seekStart+uint64(i)*seekEntry:]
+		v1 = append(v1, e[:seekEntryV1]...)
+	}
+	v1 = binary.LittleEndian.AppendUint64(v1, seekStart)
+	v1 = append(v1, compressedMagicV1...)
+	c, err := OpenCompressed(bytes.NewReader(v1), int64(len(v1)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(f, c.File); diff != "" {
+		t.Fatalf("(-want,+got)\n%s", diff)
+	}
+
+	// Future versions are reported as such.
+	v3 := bytes.Clone(b)
+	copy(v3, "STZSTD03")
+	copy(v3[len(v3)-8:], "STZSTD03")
+	if _, err := OpenCompressed(bytes.NewReader(v3), int64(len(v3)), nil); err == nil || err.Error() != `compressed: unsupported version "STZSTD03"` {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,241 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package safetensors
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// IsFloat returns true if the data type is a floating point type.
+func (dt DType) IsFloat() bool {
+	switch dt {
+	case F8_E5M2, F8_E4M3, F16, BF16, F32, F64:
+		return true
+	default:
+		return false
+	}
+}
+
+// Cast returns a copy of the tensor converted to dtype.
+//
+// Conversions go through float64. Floating point destinations round to
+// nearest even; F8_E4M3 has no infinity so out of range values become NaN.
+// Integer destinations truncate toward zero and saturate at the type's bounds,
+// NaN becomes 0. BOOL is true for any non-zero value.
+func (t *Tensor) Cast(dtype DType) (Tensor, error) {
+	if err := t.Validate(); err != nil {
+		return Tensor{}, err
+	}
+	if dtype.WordSize() == 0 {
+		return Tensor{}, errorf(ErrInvalidDType, "%q is not a valid DType", dtype)
+	}
+	src := t.DType.WordSize()
+	dst := dtype.WordSize()
+	n := uint64(len(t.Data)) / src
+	out := Tensor{Name: t.Name, DType: dtype, Shape: t.Shape, Data: make([]byte, n*dst)}
+	if dtype == t.DType {
+		copy(out.Data, t.Data)
+		return out, nil
+	}
+	for i := range n {
+		dtype.encode(out.Data[i*dst:], t.DType.decode(t.Data[i*src:]))
+	}
+	return out, nil
+}
+
+// decode decodes the little endian element at the start of b.
+func (dt DType) decode(b []byte) float64 {
+	switch dt {
+	case BOOL:
+		if b[0] != 0 {
+			return 1
+		}
+		return 0
+	case U8:
+		return float64(b[0])
+	case I8:
+		return float64(int8(b[0]))
+	case F8_E5M2:
+		return decodeMinifloat(uint64(b[0]), 5, 2, true)
+	case F8_E4M3:
+		return decodeMinifloat(uint64(b[0]), 4, 3, false)
+	case I16:
+		return float64(int16(binary.LittleEndian.Uint16(b)))
+	case U16:
+		return float64(binary.LittleEndian.Uint16(b))
+	case F16:
+		return decodeMinifloat(uint64(binary.LittleEndian.Uint16(b)), 5, 10, true)
+	case BF16:
+		return float64(math.Float32frombits(uint32(binary.LittleEndian.Uint16(b)) << 16))
+	case I32:
+		return float64(int32(binary.LittleEndian.Uint32(b)))
+	case U32:
+		return float64(binary.LittleEndian.Uint32(b))
+	case F32:
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+	case F64:
+		return math.Float64frombits(binary.LittleEndian.Uint64(b))
+	case I64:
+		return float64(int64(binary.LittleEndian.Uint64(b)))
+	case U64:
+		return float64(binary.LittleEndian.Uint64(b))
+	default:
+		panic("invalid dtype " + string(dt))
+	}
+}
+
+// encode encodes v as a little endian element at the start of b.
+func (dt DType) encode(b []byte, v float64) {
+	switch dt {
+	case BOOL:
+		b[0] = 0
+		if v != 0 {
+			b[0] = 1
+		}
+	case U8:
+		b[0] = uint8(saturate(v, 0, math.MaxUint8))
+	case I8:
+		b[0] = uint8(int8(saturate(v, math.MinInt8, math.MaxInt8)))
+	case F8_E5M2:
+		b[0] = uint8(encodeMinifloat(v, 5, 2, true))
+	case F8_E4M3:
+		b[0] = uint8(encodeMinifloat(v, 4, 3, false))
+	case I16:
+		binary.LittleEndian.PutUint16(b, uint16(int16(saturate(v, math.MinInt16, math.MaxInt16))))
+	case U16:
+		binary.LittleEndian.PutUint16(b, uint16(saturate(v, 0, math.MaxUint16)))
+	case F16:
+		binary.LittleEndian.PutUint16(b, uint16(encodeMinifloat(v, 5, 10, true)))
+	case BF16:
+		binary.LittleEndian.PutUint16(b, uint16(encodeMinifloat(v, 8, 7, true)))
+	case I32:
+		binary.LittleEndian.PutUint32(b, uint32(int32(saturate(v, math.MinInt32, math.MaxInt32))))
+	case U32:
+		binary.LittleEndian.PutUint32(b, uint32(saturate(v, 0, math.MaxUint32)))
+	case F32:
+		binary.LittleEndian.PutUint32(b, math.Float32bits(float32(v)))
+	case F64:
+		binary.LittleEndian.PutUint64(b, math.Float64bits(v))
+	case I64:
+		var i int64
+		switch {
+		case math.IsNaN(v):
+		case v >= math.MaxInt64:
+			i = math.MaxInt64
+		case v <= math.MinInt64:
+			i = math.MinInt64
+		default:
+			i = int64(v)
+		}
+		binary.LittleEndian.PutUint64(b, uint64(i))
+	case U64:
+		var u uint64
+		switch {
+		case math.IsNaN(v) || v <= 0:
+		case v >= math.MaxUint64:
+			u = math.MaxUint64
+		default:
+			u = uint64(v)
+		}
+		binary.LittleEndian.PutUint64(b, u)
+	default:
+		panic("invalid dtype " + string(dt))
+	}
+}
+
+// saturate truncates v toward zero and clamps it to [lo, hi]. NaN maps to 0.
+func saturate(v, lo, hi float64) int64 {
+	switch {
+	case math.IsNaN(v):
+		return 0
+	case v <= lo:
+		return int64(lo)
+	case v >= hi:
+		return int64(hi)
+	default:
+		return int64(v)
+	}
+}
+
+// decodeMinifloat decodes a binary floating point number with expBits of
+// exponent and manBits of mantissa.
+//
+// When ieee is false, the format has no infinity and only the all ones
+// pattern is NaN, like F8_E4M3.
+func decodeMinifloat(bits uint64, expBits, manBits int, ieee bool) float64 {
+	expMask := uint64(1)<<expBits - 1
+	manMask := uint64(1)<<manBits - 1
+	exp := (bits >> manBits) & expMask
+	man := bits & manMask
+	bias := 1<<(expBits-1) - 1
+	var v float64
+	switch {
+	case ieee && exp == expMask:
+		if man != 0 {
+			return math.NaN()
+		}
+		v = math.Inf(1)
+	case !ieee && exp == expMask && man == manMask:
+		return math.NaN()
+	case exp == 0:
+		v = math.Ldexp(float64(man), 1-bias-manBits)
+	default:
+		v = math.Ldexp(float64(man|1<<manBits), int(exp)-bias-manBits)
+	}
+	if bits>>(expBits+manBits)&1 != 0 {
+		v = -v
+	}
+	return v
+}
+
+// encodeMinifloat is the inverse of decodeMinifloat, rounding to nearest
+// even.
+//
+// When ieee is false, values out of range become NaN.
+func encodeMinifloat(v float64, expBits, manBits int, ieee bool) uint64 {
+	expMask := uint64(1)<<expBits - 1
+	manMask := uint64(1)<<manBits - 1
+	sign := uint64(0)
+	if math.Signbit(v) {
+		sign = 1 << (expBits + manBits)
+		v = -v
+	}
+	nan := sign | expMask<<manBits | manMask
+	if ieee {
+		nan = sign | expMask<<manBits | 1<<(manBits-1)
+	}
+	if math.IsNaN(v) {
+		return nan
+	}
+	bias := 1<<(expBits-1) - 1
+	minExp := 1 - bias
+	maxExp := int(expMask) - 1 - bias
+	maxMan := float64(manMask)
+	if !ieee {
+		maxExp++
+		maxMan--
+	}
+	maxFinite := math.Ldexp(1+maxMan/float64(manMask+1), maxExp)
+	// Quantize to the precision available at v's magnitude.
+	e := minExp
+	if _, exp := math.Frexp(v); exp-1 > minExp {
+		e = exp - 1
+	}
+	r := math.Ldexp(math.RoundToEven(math.Ldexp(v, manBits-e)), e-manBits)
+	if r > maxFinite {
+		if !ieee {
+			return nan
+		}
+		return sign | expMask<<manBits
+	}
+	if r < math.Ldexp(1, minExp) {
+		return sign | uint64(math.Ldexp(r, manBits-minExp))
+	}
+	_, exp := math.Frexp(r)
+	e = exp - 1
+	man := uint64(math.Ldexp(r, manBits-e)) & manMask
+	return sign | uint64(e+bias)<<manBits | man
+}
@@ -0,0 +1,106 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package safetensors
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMinifloat(t *testing.T) {
+	data := []struct {
+		dtype DType
+		bits  uint64
+		v     float64
+	}{
+		{F16, 0x0000, 0},
+		{F16, 0x3C00, 1},
+		{F16, 0xC000, -2},
+		{F16, 0x7BFF, 65504},
+		{F16, 0x0001, math.Ldexp(1, -24)},
+		{F16, 0x7C00, math.Inf(1)},
+		{F16, 0xFC00, math.Inf(-1)},
+		{BF16, 0x3F80, 1},
+		{BF16, 0xC040, -3},
+		{F8_E5M2, 0x3C, 1},
+		{F8_E5M2, 0x7B, 57344},
+		{F8_E5M2, 0x7C, math.Inf(1)},
+		{F8_E4M3, 0x38, 1},
+		{F8_E4M3, 0x7E, 448},
+		{F8_E4M3, 0x01, math.Ldexp(1, -9)},
+		{F8_E4M3, 0xB8, -1},
+	}
+	for _, line := range data {
+		b := make([]byte, line.dtype.WordSize())
+		line.dtype.encode(b, line.v)
+		if got := line.dtype.decode(b); got != line.v {
+			t.Errorf("%s %g: got %g", line.dtype, line.v, got)
+		}
+		var bits uint64
+		for i := len(b) - 1; i >= 0; i-- {
+			bits = bits<<8 | uint64(b[i])
+		}
+		if bits != line.bits {
+			t.Errorf("%s %g: want 0x%X, got 0x%X", line.dtype, line.v, line.bits, bits)
+		}
+	}
+}
+
+func TestMinifloat_Rounding(t *testing.T) {
+	// 1+2^-11 is exactly between 1 and the next F16; ties round to even.
+	if got := encodeMinifloat(1+math.Ldexp(1, -11), 5, 10, true); got != 0x3C00 {
+		t.Fatalf("0x%X", got)
+	}
+	if got := encodeMinifloat(1+3*math.Ldexp(1, -11), 5, 10, true); got != 0x3C02 {
+		t.Fatalf("0x%X", got)
+	}
+	if got := encodeMinifloat(100000, 5, 10, true); got != 0x7C00 {
+		t.Fatalf("0x%X", got)
+	}
+	if got := encodeMinifloat(1000, 4, 3, false); got != 0x7F {
+		t.Fatalf("0x%X", got)
+	}
+	if got := decodeMinifloat(0x7F, 4, 3, false); !math.IsNaN(got) {
+		t.Fatal(got)
+	}
+	if got := encodeMinifloat(math.NaN(), 5, 10, true); got != 0x7E00 {
+		t.Fatalf("0x%X", got)
+	}
+}
+
+func TestTensor_Cast(t *testing.T) {
+	src := Tensor{Name: "x", DType: F32, Shape: []uint64{4}, Data: make([]byte, 16)}
+	for i, v := range []float64{1.5, -2.25, 300, math.NaN()} {
+		F32.encode(src.Data[4*i:], v)
+	}
+	data := []struct {
+		dtype DType
+		want  []float64
+	}{
+		{BF16, []float64{1.5, -2.25, 300, math.NaN()}},
+		{F16, []float64{1.5, -2.25, 300, math.NaN()}},
+		{I8, []float64{1, -2, 127, 0}},
+		{U8, []float64{1, 0, 255, 0}},
+		{BOOL, []float64{1, 1, 1, 1}},
+	}
+	for _, line := range data {
+		got, err := src.Cast(line.dtype)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := got.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		for i, w := range line.want {
+			v := line.dtype.decode(got.Data[uint64(i)*line.dtype.WordSize():])
+			if v != w && !(math.IsNaN(v) && math.IsNaN(w)) {
+				t.Errorf("%s #%d: want %g, got %g", line.dtype, i, w, v)
+			}
+		}
+	}
+	if _, err := src.Cast("bad"); err == nil {
+		t.Fatal("expected error")
+	}
+}
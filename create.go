@@ -0,0 +1,142 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package safetensors
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/edsrzf/mmap-go"
+)
+
+// Created is a safetensors file being created directly in a writable memory
+// mapping.
+//
+// Each Tensor.Data points into the mapping and must be filled in place by the
+// caller before calling Commit.
+type Created struct {
+	*File
+	name string
+	f    *os.File
+	m    mmap.MMap
+}
+
+// Create preallocates a temporary file next to name at its final size, writes
+// the header and memory maps it writable.
+//
+// Only Name, DType and Shape of desc.Tensors are used; Data must be nil.
+// desc.Metadata is written as is. The returned Tensors' Data slices are zero
+// initialized and point into the mapping.
+//
+// The file only becomes visible at name once Commit succeeds, with permission
+// 0o644 like WriteFile. Call Abort to discard it.
+func Create(name string, desc *File) (*Created, error) {
+	h := safeTensorsHeader{metadata: desc.Metadata, rawMetadata: desc.RawMetadata, tensors: make([]tensorInfo, len(desc.Tensors))}
+	var offset uint64
+	for i := range desc.Tensors {
+		t := &desc.Tensors[i]
+		if t.Data != nil {
+			return nil, fmt.Errorf("tensor %q #%d: Data must be nil", t.Name, i)
+		}
+		if t.DType.WordSize() == 0 {
+			return nil, &TensorError{Name: t.Name, Index: i, Err: errorf(ErrInvalidDType, "%q is not a valid DType", t.DType)}
+		}
+		n, err := byteSize(t.DType, t.Shape)
+		if err != nil {
+			return nil, &TensorError{Name: t.Name, Index: i, Err: err}
+		}
+		h.tensors[i] = tensorInfo{name: t.Name, DType: t.DType, Shape: t.Shape, DataOffsets: [2]uint64{offset, offset + n}, extra: t.Extra}
+		if t.Shape == nil {
+			h.tensors[i].Shape = []uint64{}
+		}
+		if offset += n; offset < n {
+			return nil, errorf(ErrOverflow, "total size overflow")
+		}
+	}
+	b, err := h.encode(0)
+	if err != nil {
+		return nil, err
+	}
+	size := uint64(len(b)) + offset
+	if size > math.MaxInt {
+		return nil, errorf(ErrOverflow, "data too large: %d", size)
+	}
+	f, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	c := &Created{name: name, f: f}
+	if err = f.Truncate(int64(size)); err == nil {
+		c.m, err = mmap.MapRegion(f, int(size), mmap.RDWR, 0, 0)
+	}
+	if err != nil {
+		_ = c.Abort()
+		return nil, err
+	}
+	copy(c.m, b)
+	c.File = &File{Metadata: desc.Metadata, RawMetadata: desc.RawMetadata, Tensors: make([]Tensor, len(h.tensors))}
+	data := c.m[len(b):]
+	for i := range h.tensors {
+		h.tensors[i].toTensor(&c.Tensors[i], data[h.tensors[i].DataOffsets[0]:h.tensors[i].DataOffsets[1]])
+	}
+	return c, nil
+}
+
+// Commit flushes the mapping, syncs the file to disk and atomically renames it
+// to its final name.
+//
+// The Tensors' Data must not be accessed afterward.
+func (c *Created) Commit() error {
+	if c.f == nil {
+		return errors.New("already closed")
+	}
+	err := c.m.Flush()
+	if err2 := c.m.Unmap(); err == nil {
+		err = err2
+	}
+	c.m = nil
+	if err == nil {
+		err = c.f.Chmod(0o644)
+	}
+	if err == nil {
+		err = c.f.Sync()
+	}
+	if err2 := c.f.Close(); err == nil {
+		err = err2
+	}
+	if err == nil {
+		err = os.Rename(c.f.Name(), c.name)
+	}
+	if err != nil {
+		_ = os.Remove(c.f.Name())
+	}
+	c.f = nil
+	c.File = nil
+	return err
+}
+
+// Abort discards the file being created.
+func (c *Created) Abort() error {
+	if c.f == nil {
+		return errors.New("already closed")
+	}
+	var err error
+	if c.m != nil {
+		err = c.m.Unmap()
+		c.m = nil
+	}
+	if err2 := c.f.Close(); err == nil {
+		err = err2
+	}
+	if err2 := os.Remove(c.f.Name()); err == nil {
+		err = err2
+	}
+	c.f = nil
+	c.File = nil
+	return err
+}
@@ -0,0 +1,75 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package safetensors
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCreate(t *testing.T) {
+	want := makeTestFile(5)
+	want.Metadata = map[string]string{"foo": "bar"}
+	desc := &File{Metadata: want.Metadata}
+	for _, t := range want.Tensors {
+		desc.Tensors = append(desc.Tensors, Tensor{Name: t.Name, DType: t.DType, Shape: t.Shape})
+	}
+	n := filepath.Join(t.TempDir(), "model.safetensors")
+	c, err := Create(n, desc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range c.Tensors {
+		copy(c.Tensors[i].Data, want.Tensors[i].Data)
+	}
+	if _, err := os.Stat(n); !os.IsNotExist(err) {
+		t.Fatal("file must not be visible before Commit")
+	}
+	if err := c.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Commit(); err == nil {
+		t.Fatal("expected error")
+	}
+	fi, err := os.Stat(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0o644 && os.PathSeparator == '/' {
+		t.Fatal(fi.Mode())
+	}
+	got, err := os.ReadFile(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := bytes.Buffer{}
+	if err := want.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(buf.Bytes(), got); diff != "" {
+		t.Fatalf("(-want,+got)\n%s", diff)
+	}
+}
+
+func TestCreate_Abort(t *testing.T) {
+	dir := t.TempDir()
+	c, err := Create(filepath.Join(dir, "model.safetensors"), &File{Tensors: []Tensor{{Name: "a", DType: U8, Shape: []uint64{3}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Abort(); err != nil {
+		t.Fatal(err)
+	}
+	if e, err := os.ReadDir(dir); err != nil || len(e) != 0 {
+		t.Fatal(e, err)
+	}
+	if _, err := Create(filepath.Join(dir, "x"), &File{Tensors: []Tensor{{Name: "a", DType: U8, Shape: []uint64{1}, Data: []byte{1}}}}); err == nil || err.Error() != "tensor \"a\" #0: Data must be nil" {
+		t.Fatal(err)
+	}
+}
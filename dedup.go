@@ -0,0 +1,143 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package safetensors
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"unsafe"
+)
+
+// MetadataAliases is the "__metadata__" key listing the tensors removed by
+// File.Dedup. Its value is a JSON object mapping each removed tensor's name to
+// the name of the identical tensor kept in the file.
+const MetadataAliases = "safetensors.aliases"
+
+// Dedup returns a File without the tensors identical to a previous tensor,
+// e.g. tied weights. The removed tensors are recorded in
+// Metadata[MetadataAliases].
+//
+// Tensors are identical when they have the same dtype and shape and their Data
+// either is the same memory or has the same content. Empty tensors are kept.
+// f is returned as is when there is no duplicate.
+//
+// Since the format disallows overlapping data, this is the only way to store
+// a tensor once. Use ExpandAliases after reading the file to restore the
+// removed tensors.
+func (f *File) Dedup() (*File, error) {
+	aliases, err := f.aliases()
+	if err != nil {
+		return nil, err
+	}
+	type key struct {
+		dtype DType
+		shape string
+		size  int
+	}
+	// Group the candidates by dtype, shape and size first, to only hash the
+	// tensors that may be duplicates.
+	groups := map[key][]int{}
+	for i := range f.Tensors {
+		t := &f.Tensors[i]
+		if err := t.Validate(); err != nil {
+			return nil, &TensorError{Name: t.Name, Index: i, Err: err}
+		}
+		if len(t.Data) == 0 {
+			continue
+		}
+		k := key{t.DType, fmt.Sprint(t.Shape), len(t.Data)}
+		groups[k] = append(groups[k], i)
+	}
+	dup := map[int]int{}
+	for _, g := range groups {
+		if len(g) < 2 {
+			continue
+		}
+		kept := map[[sha256.Size]byte][]int{}
+		for _, i := range g {
+			d := f.Tensors[i].Data
+			h := sha256.Sum256(d)
+			j := slices.IndexFunc(kept[h], func(j int) bool {
+				o := f.Tensors[j].Data
+				return unsafe.SliceData(o) == unsafe.SliceData(d) || bytes.Equal(o, d)
+			})
+			if j == -1 {
+				kept[h] = append(kept[h], i)
+			} else {
+				dup[i] = kept[h][j]
+			}
+		}
+	}
+	if len(dup) == 0 {
+		return f, nil
+	}
+	out := &File{Metadata: maps.Clone(f.Metadata), RawMetadata: f.RawMetadata}
+	for i := range f.Tensors {
+		if j, ok := dup[i]; ok {
+			aliases[f.Tensors[i].Name] = f.Tensors[j].Name
+		} else {
+			out.Tensors = append(out.Tensors, f.Tensors[i])
+		}
+	}
+	// Previously recorded aliases may point to a removed tensor.
+	for k, v := range aliases {
+		if v2, ok := aliases[v]; ok {
+			aliases[k] = v2
+		}
+	}
+	b, err := marshal(aliases)
+	if err != nil {
+		return nil, err
+	}
+	if out.Metadata == nil {
+		out.Metadata = map[string]string{}
+	}
+	out.Metadata[MetadataAliases] = string(b)
+	return out, nil
+}
+
+// ExpandAliases adds back the tensors recorded in Metadata[MetadataAliases]
+// by Dedup and removes the key.
+//
+// The restored tensors share the Data of the tensor they alias and are
+// appended in name order.
+func (f *File) ExpandAliases() error {
+	aliases, err := f.aliases()
+	if err != nil || len(aliases) == 0 {
+		return err
+	}
+	var added []Tensor
+	for _, name := range slices.Sorted(maps.Keys(aliases)) {
+		target := aliases[name]
+		if slices.ContainsFunc(f.Tensors, func(t Tensor) bool { return t.Name == name }) {
+			return errorf(ErrDuplicateName, "alias %q is also a tensor", name)
+		}
+		i := slices.IndexFunc(f.Tensors, func(t Tensor) bool { return t.Name == target })
+		if i == -1 {
+			return fmt.Errorf("alias %q: tensor %q not found", name, target)
+		}
+		t := f.Tensors[i]
+		t.Name = name
+		added = append(added, t)
+	}
+	f.Tensors = append(f.Tensors, added...)
+	delete(f.Metadata, MetadataAliases)
+	return nil
+}
+
+// aliases returns a copy of the decoded Metadata[MetadataAliases].
+func (f *File) aliases() (map[string]string, error) {
+	aliases := map[string]string{}
+	if v, ok := f.Metadata[MetadataAliases]; ok {
+		if err := json.Unmarshal([]byte(v), &aliases); err != nil {
+			return nil, fmt.Errorf("invalid %q metadata: %w", MetadataAliases, err)
+		}
+	}
+	return aliases, nil
+}
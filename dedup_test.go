@@ -0,0 +1,107 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package safetensors
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSerialize_Dedup(t *testing.T) {
+	emb := []byte{1, 2, 3, 4}
+	f := &File{
+		Metadata: map[string]string{"a": "b"},
+		Tensors: []Tensor{
+			{Name: "embed", DType: U8, Shape: []uint64{4}, Data: emb},
+			{Name: "other", DType: U8, Shape: []uint64{4}, Data: []byte{1, 2, 3, 5}},
+			{Name: "copy", DType: U8, Shape: []uint64{4}, Data: []byte{1, 2, 3, 4}},
+			// Same bytes but different shape.
+			{Name: "reshaped", DType: U8, Shape: []uint64{2, 2}, Data: emb},
+			{Name: "lm_head", DType: U8, Shape: []uint64{4}, Data: emb},
+			{Name: "e1", DType: U8, Shape: []uint64{0}, Data: []byte{}},
+			{Name: "e2", DType: U8, Shape: []uint64{0}, Data: []byte{}},
+		},
+	}
+	out := bytes.Buffer{}
+	if err := f.SerializeContext(context.Background(), &out, &SerializeOptions{Dedup: true}); err != nil {
+		t.Fatal(err)
+	}
+	if out.Len() != 8+int(binary.LittleEndian.Uint64(out.Bytes()))+12 {
+		t.Fatalf("data was not deduplicated: %d", out.Len())
+	}
+	g, err := Parse(out.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"a": "b", MetadataAliases: `{"copy":"embed","lm_head":"embed"}`}
+	if diff := cmp.Diff(want, g.Metadata); diff != "" {
+		t.Fatalf("(-want,+got)\n%s", diff)
+	}
+	if len(g.Tensors) != 5 {
+		t.Fatal(len(g.Tensors))
+	}
+	if err := g.ExpandAliases(); err != nil {
+		t.Fatal(err)
+	}
+	wantNames := []string{"embed", "other", "reshaped", "e1", "e2", "copy", "lm_head"}
+	var names []string
+	for _, tensor := range g.Tensors {
+		names = append(names, tensor.Name)
+	}
+	if diff := cmp.Diff(wantNames, names); diff != "" {
+		t.Fatalf("(-want,+got)\n%s", diff)
+	}
+	if diff := cmp.Diff(f.Tensors[4], g.Tensors[6]); diff != "" {
+		t.Fatalf("(-want,+got)\n%s", diff)
+	}
+	if diff := cmp.Diff(map[string]string{"a": "b"}, g.Metadata); diff != "" {
+		t.Fatalf("(-want,+got)\n%s", diff)
+	}
+
+	// No duplicate.
+	h := makeTestFile(3)
+	if d, err := h.Dedup(); err != nil || d != h {
+		t.Fatal(d, err)
+	}
+}
+
+func TestFile_Dedup_Chained(t *testing.T) {
+	f := &File{
+		Metadata: map[string]string{MetadataAliases: `{"c":"b"}`},
+		Tensors: []Tensor{
+			{Name: "a", DType: U8, Shape: []uint64{1}, Data: []byte{1}},
+			{Name: "b", DType: U8, Shape: []uint64{1}, Data: []byte{1}},
+		},
+	}
+	d, err := f.Dedup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := d.Metadata[MetadataAliases]; got != `{"b":"a","c":"a"}` {
+		t.Fatal(got)
+	}
+	if err := d.ExpandAliases(); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Tensors) != 3 || len(f.Tensors) != 2 {
+		t.Fatal(d.Tensors)
+	}
+	f.Metadata[MetadataAliases] = `{"c":"missing"}`
+	if err := f.ExpandAliases(); err == nil {
+		t.Fatal("expected error")
+	}
+	f.Metadata[MetadataAliases] = `{"a":"b"}`
+	if err := f.ExpandAliases(); err == nil {
+		t.Fatal("expected error")
+	}
+	f.Metadata[MetadataAliases] = `[`
+	if _, err := f.Dedup(); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,217 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package safetensors
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// MetadataDelta is the "__metadata__" key describing a delta file created by
+// Delta. Its value is a JSON object with the hex encoded Digest of the base as
+// "base" and the list of the target's tensors, in order, as "tensors", each
+// with its "name" and how it is stored as "op":
+//   - "same": not stored, identical in the base;
+//   - "xor": stored as the XOR of the target and base data;
+//   - "sub": stored as the difference between the target and base elements,
+//     as wrapping little endian unsigned integers of the dtype's word size;
+//   - "full": stored as is.
+const MetadataDelta = "safetensors.delta"
+
+// DeltaMethod is the way a changed tensor is encoded in a delta file.
+type DeltaMethod int
+
+const (
+	// DeltaXOR stores the XOR of the target and base bytes. Unchanged bits
+	// become zeros, which compress well.
+	DeltaXOR DeltaMethod = iota
+	// DeltaSub stores the wrapping difference between the target and base
+	// elements' bit patterns. It is lossless and suits integer tensors.
+	DeltaSub
+)
+
+type deltaInfo struct {
+	Base    string       `json:"base"`
+	Tensors []deltaEntry `json:"tensors"`
+}
+
+type deltaEntry struct {
+	Name string `json:"name"`
+	Op   string `json:"op"`
+}
+
+// Digest returns the SHA-256 of the tensors, independently of the metadata
+// and of the file layout.
+//
+// It is the hash of the canonical serialization of the tensors. See
+// SerializeOptions.Canonical.
+func (f *File) Digest() ([]byte, error) {
+	g := &File{Tensors: slices.Clone(f.Tensors)}
+	for i := range g.Tensors {
+		g.Tensors[i].Extra = nil
+	}
+	h := sha256.New()
+	if err := g.SerializeContext(context.Background(), h, &SerializeOptions{Canonical: true}); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// Delta returns a file that only contains the tensors of target that differ
+// from base. The tensors present in both with the same dtype and shape are
+// encoded with method, the others are stored as is.
+//
+// The delta references base by its Digest and keeps the target's Metadata.
+// Since a file requires at least one tensor, the first tensor is stored as is
+// when none changed. Use ApplyDelta to reconstruct target.
+func Delta(base, target *File, method DeltaMethod) (*File, error) {
+	op := ""
+	switch method {
+	case DeltaXOR:
+		op = "xor"
+	case DeltaSub:
+		op = "sub"
+	default:
+		return nil, fmt.Errorf("invalid delta method %d", method)
+	}
+	if _, ok := target.Metadata[MetadataDelta]; ok {
+		return nil, errors.New("target is already a delta")
+	}
+	digest, err := base.Digest()
+	if err != nil {
+		return nil, fmt.Errorf("base: %w", err)
+	}
+	info := deltaInfo{Base: hex.EncodeToString(digest), Tensors: make([]deltaEntry, len(target.Tensors))}
+	out := &File{Metadata: maps.Clone(target.Metadata)}
+	for i := range target.Tensors {
+		t := &target.Tensors[i]
+		if err := t.Validate(); err != nil {
+			return nil, &TensorError{Name: t.Name, Index: i, Err: err}
+		}
+		info.Tensors[i].Name = t.Name
+		b := findTensor(base, t.Name)
+		switch {
+		case b == nil || b.DType != t.DType || !slices.Equal(b.Shape, t.Shape):
+			info.Tensors[i].Op = "full"
+			out.Tensors = append(out.Tensors, Tensor{Name: t.Name, DType: t.DType, Shape: t.Shape, Data: t.Data})
+		case bytes.Equal(b.Data, t.Data):
+			info.Tensors[i].Op = "same"
+		default:
+			info.Tensors[i].Op = op
+			d := make([]byte, len(t.Data))
+			applyOp(op, t.DType, d, t.Data, b.Data, false)
+			out.Tensors = append(out.Tensors, Tensor{Name: t.Name, DType: t.DType, Shape: t.Shape, Data: d})
+		}
+	}
+	if len(out.Tensors) == 0 && len(target.Tensors) != 0 {
+		// A file without tensors is invalid, store the first one as is.
+		info.Tensors[0].Op = "full"
+		t := &target.Tensors[0]
+		out.Tensors = append(out.Tensors, Tensor{Name: t.Name, DType: t.DType, Shape: t.Shape, Data: t.Data})
+	}
+	v, err := marshal(info)
+	if err != nil {
+		return nil, err
+	}
+	if out.Metadata == nil {
+		out.Metadata = map[string]string{}
+	}
+	out.Metadata[MetadataDelta] = string(v)
+	return out, nil
+}
+
+// ApplyDelta reconstructs the target file from base and a delta created by
+// Delta. It fails if base's Digest doesn't match the one recorded in delta.
+//
+// The tensors identical to base share its Data.
+func ApplyDelta(base, delta *File) (*File, error) {
+	v, ok := delta.Metadata[MetadataDelta]
+	if !ok {
+		return nil, fmt.Errorf("not a delta: missing %q metadata", MetadataDelta)
+	}
+	var info deltaInfo
+	if err := json.Unmarshal([]byte(v), &info); err != nil {
+		return nil, fmt.Errorf("invalid %q metadata: %w", MetadataDelta, err)
+	}
+	digest, err := base.Digest()
+	if err != nil {
+		return nil, fmt.Errorf("base: %w", err)
+	}
+	if got := hex.EncodeToString(digest); got != info.Base {
+		return nil, fmt.Errorf("base digest mismatch: expected %s, got %s", info.Base, got)
+	}
+	out := &File{Metadata: maps.Clone(delta.Metadata), Tensors: make([]Tensor, len(info.Tensors))}
+	delete(out.Metadata, MetadataDelta)
+	for i, e := range info.Tensors {
+		b := findTensor(base, e.Name)
+		if e.Op == "same" {
+			if b == nil {
+				return nil, &TensorError{Name: e.Name, Index: i, Err: errors.New("not found in base")}
+			}
+			out.Tensors[i] = *b
+			continue
+		}
+		d := findTensor(delta, e.Name)
+		if d == nil {
+			return nil, &TensorError{Name: e.Name, Index: i, Err: errors.New("not found in delta")}
+		}
+		t := Tensor{Name: e.Name, DType: d.DType, Shape: d.Shape, Data: d.Data}
+		switch e.Op {
+		case "full":
+		case "xor", "sub":
+			if b == nil || b.DType != d.DType || !slices.Equal(b.Shape, d.Shape) || len(b.Data) != len(d.Data) {
+				return nil, &TensorError{Name: e.Name, Index: i, Err: errors.New("mismatch with base")}
+			}
+			t.Data = make([]byte, len(d.Data))
+			applyOp(e.Op, d.DType, t.Data, d.Data, b.Data, true)
+		default:
+			return nil, &TensorError{Name: e.Name, Index: i, Err: fmt.Errorf("invalid op %q", e.Op)}
+		}
+		if err := t.Validate(); err != nil {
+			return nil, &TensorError{Name: e.Name, Index: i, Err: err}
+		}
+		out.Tensors[i] = t
+	}
+	return out, nil
+}
+
+// applyOp computes dst = a op b, or its inverse dst = a op⁻¹ b when inverse
+// is true.
+func applyOp(op string, dt DType, dst, a, b []byte, inverse bool) {
+	if op == "xor" {
+		for i := range dst {
+			dst[i] = a[i] ^ b[i]
+		}
+		return
+	}
+	// Propagate the carry within each little endian word.
+	w := int(dt.WordSize())
+	for i := 0; i < len(dst); i += w {
+		carry := 0
+		for j := i; j < i+w; j++ {
+			v := int(a[j]) - int(b[j]) + carry
+			if inverse {
+				v = int(a[j]) + int(b[j]) + carry
+			}
+			dst[j] = byte(v)
+			carry = v >> 8
+		}
+	}
+}
+
+func findTensor(f *File, name string) *Tensor {
+	i := slices.IndexFunc(f.Tensors, func(t Tensor) bool { return t.Name == name })
+	if i == -1 {
+		return nil
+	}
+	return &f.Tensors[i]
+}
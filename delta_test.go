@@ -0,0 +1,114 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package safetensors
+
+import (
+	"bytes"
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDelta(t *testing.T) {
+	base := makeTestFile(4)
+	base.Metadata = map[string]string{"step": "0"}
+	target := &File{Metadata: map[string]string{"step": "100"}, Tensors: slices.Clone(base.Tensors)}
+	// Changed.
+	target.Tensors[1].Data = bytes.Clone(target.Tensors[1].Data)
+	F32.encode(target.Tensors[1].Data, 1.5)
+	// Reshaped.
+	target.Tensors[2].Shape = []uint64{1, 2}
+	// Removed t3, added new.
+	target.Tensors = append(target.Tensors[:3], Tensor{Name: "new", DType: I64, Shape: []uint64{1}, Data: []byte{1, 2, 3, 4, 5, 6, 7, 0xFF}})
+	// Changed integer with a borrow.
+	base.Tensors = append(base.Tensors, Tensor{Name: "ints", DType: I16, Shape: []uint64{2}, Data: []byte{0xFF, 0x00, 0x00, 0x01}})
+	target.Tensors = append(target.Tensors, Tensor{Name: "ints", DType: I16, Shape: []uint64{2}, Data: []byte{0x00, 0x01, 0xFF, 0x00}})
+
+	for _, method := range []DeltaMethod{DeltaXOR, DeltaSub} {
+		d, err := Delta(base, target, method)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var info deltaInfo
+		if err := json.Unmarshal([]byte(d.Metadata[MetadataDelta]), &info); err != nil {
+			t.Fatal(err)
+		}
+		op := "xor"
+		if method == DeltaSub {
+			op = "sub"
+		}
+		want := []deltaEntry{{"t0", "same"}, {"t1", op}, {"t2", "full"}, {"new", "full"}, {"ints", op}}
+		if diff := cmp.Diff(want, info.Tensors); diff != "" {
+			t.Fatalf("(-want,+got)\n%s", diff)
+		}
+		if len(d.Tensors) != 4 {
+			t.Fatal(len(d.Tensors))
+		}
+
+		// Round trip through serialization.
+		buf := bytes.Buffer{}
+		if err := d.Serialize(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if d, err = Parse(buf.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ApplyDelta(base, d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(target, got); diff != "" {
+			t.Fatalf("(-want,+got)\n%s", diff)
+		}
+
+		// Wrong base.
+		if _, err := ApplyDelta(target, d); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+	// No change.
+	d, err := Delta(base, base, DeltaXOR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Tensors) != 1 || d.Tensors[0].Name != "t0" {
+		t.Fatal(d.Tensors)
+	}
+	if got, err := ApplyDelta(base, d); err != nil {
+		t.Fatal(err)
+	} else if diff := cmp.Diff(base, got); diff != "" {
+		t.Fatalf("(-want,+got)\n%s", diff)
+	}
+	if _, err := Delta(base, target, 42); err == nil {
+		t.Fatal("expected error")
+	}
+	if _, err := ApplyDelta(base, base); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestFile_Digest(t *testing.T) {
+	f := makeTestFile(3)
+	want, err := f.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Independent of the metadata and the order.
+	g := &File{Metadata: map[string]string{"a": "b"}, Tensors: slices.Clone(f.Tensors)}
+	slices.Reverse(g.Tensors)
+	got, err := g.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(want, got) {
+		t.Fatal("digest mismatch")
+	}
+	g.Tensors[0].Shape = []uint64{1, 2}
+	if got, _ = g.Digest(); bytes.Equal(want, got) {
+		t.Fatal("expected different digest")
+	}
+}
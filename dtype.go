@@ -7,7 +7,6 @@ package safetensors
 
 import (
 	"encoding/json"
-	"fmt"
 )
 
 // DType identifies a data type.
@@ -81,7 +80,7 @@ func (dt *DType) UnmarshalJSON(data []byte) error {
 		return err
 	}
 	if DTypeToWordSize[DType(s)] == 0 {
-		return fmt.Errorf("%q is not a valid DType", s)
+		return errorf(ErrInvalidDType, "%q is not a valid DType", s)
 	}
 	*dt = DType(s)
 	return nil
@@ -0,0 +1,93 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package safetensors
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Sentinel errors. Use errors.Is to check for them, and errors.As with
+// *HeaderError or *TensorError to get the details.
+var (
+	// ErrHeaderTooLarge is returned when the header length exceeds the
+	// maximum allowed.
+	ErrHeaderTooLarge = errors.New("header too large")
+	// ErrTruncated is returned when the data is shorter than declared.
+	ErrTruncated = errors.New("truncated")
+	// ErrTrailingData is returned when there is data past the last tensor.
+	ErrTrailingData = errors.New("trailing data")
+	// ErrInvalidDType is returned for an unknown data type.
+	ErrInvalidDType = errors.New("invalid dtype")
+	// ErrOffsetMismatch is returned when data offsets are not contiguous or
+	// do not match the tensor's size.
+	ErrOffsetMismatch = errors.New("offset mismatch")
+	// ErrShapeMismatch is returned when a Tensor's Data length doesn't match
+	// its DType and Shape.
+	ErrShapeMismatch = errors.New("shape mismatch")
+	// ErrOverflow is returned when a size computation overflows.
+	ErrOverflow = errors.New("overflow")
+	// ErrDuplicateName is returned for duplicate tensor names or keys.
+	ErrDuplicateName = errors.New("duplicate name")
+	// ErrLimitExceeded is returned when a limit in ParseOptions is exceeded.
+	ErrLimitExceeded = errors.New("limit exceeded")
+)
+
+// HeaderError is an error about the JSON header as a whole.
+type HeaderError struct {
+	Err error
+}
+
+func (e *HeaderError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *HeaderError) Unwrap() error {
+	return e.Err
+}
+
+// TensorError is an error about a single tensor entry in the header.
+type TensorError struct {
+	// Name is the tensor name.
+	Name string
+	// Index is the index of the tensor. Depending on the check, it is the
+	// position in the header or in the data.
+	Index int
+	// Offsets are the tensor's data offsets as found in the header, if
+	// known.
+	Offsets [2]uint64
+	Err     error
+}
+
+func (e *TensorError) Error() string {
+	return fmt.Sprintf("tensor %q #%d: %s", e.Name, e.Index, e.Err)
+}
+
+func (e *TensorError) Unwrap() error {
+	return e.Err
+}
+
+// kindError is an error with a specific message that matches a sentinel error
+// with errors.Is.
+type kindError struct {
+	kind error
+	err  error
+}
+
+func errorf(kind error, format string, a ...any) error {
+	return &kindError{kind: kind, err: fmt.Errorf(format, a...)}
+}
+
+func (e *kindError) Error() string {
+	return e.err.Error()
+}
+
+func (e *kindError) Is(target error) bool {
+	return target == e.kind
+}
+
+func (e *kindError) Unwrap() error {
+	return e.err
+}
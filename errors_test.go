@@ -0,0 +1,78 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package safetensors
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func TestParse_ErrorTypes(t *testing.T) {
+	data := []struct {
+		name   string
+		in     []byte
+		kind   error
+		header bool
+	}{
+		{"trailing", makeRaw(`{"a":{"dtype":"U8","shape":[1],"data_offsets":[0,1]}}`, 2), ErrTrailingData, false},
+		{"truncated", makeRaw(`{"a":{"dtype":"U8","shape":[2],"data_offsets":[0,2]}}`, 1), ErrTruncated, false},
+		{"too small", []byte{1, 2}, ErrTruncated, true},
+		{"too large", []byte{0, 0, 0, 0, 0, 0, 0, 1}, ErrHeaderTooLarge, true},
+		{"dtype", makeRaw(`{"a":{"dtype":"U7","shape":[1],"data_offsets":[0,1]}}`, 1), ErrInvalidDType, true},
+		{"json", makeRaw(`{"a":`, 0), nil, true},
+		{"not object", makeRaw(`"a"`, 0), nil, true},
+		{"missing dtype", makeRaw(`{"a":{"shape":[],"data_offsets":[0,0]}}`, 0), ErrInvalidDType, false},
+		{"null shape", makeRaw(`{"a":{"dtype":"U8","shape":null,"data_offsets":[0,1]}}`, 1), nil, false},
+		{"gap", makeRaw(`{"a":{"dtype":"U8","shape":[1],"data_offsets":[1,2]}}`, 2), ErrOffsetMismatch, false},
+		{"overflow", makeRaw(`{"a":{"dtype":"U8","shape":[4294967296,4294967296],"data_offsets":[0,1]}}`, 1), ErrOverflow, false},
+	}
+	for i, line := range data {
+		t.Run(strconv.Itoa(i)+": "+line.name, func(t *testing.T) {
+			_, err := Parse(line.in)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if line.kind != nil && !errors.Is(err, line.kind) {
+				t.Fatalf("want %v, got %v", line.kind, err)
+			}
+			var he *HeaderError
+			if errors.As(err, &he) != line.header {
+				t.Fatalf("HeaderError: %#v", err)
+			}
+		})
+	}
+}
+
+func TestParse_TensorError(t *testing.T) {
+	d := makeRaw(`{"a":{"dtype":"U8","shape":[1],"data_offsets":[0,1]},"b":{"dtype":"U8","shape":[1],"data_offsets":[2,3]}}`, 3)
+	_, err := Parse(d)
+	var te *TensorError
+	if !errors.As(err, &te) {
+		t.Fatalf("%#v", err)
+	}
+	if te.Name != "b" || te.Index != 1 || te.Offsets != [2]uint64{2, 3} || !errors.Is(err, ErrOffsetMismatch) {
+		t.Fatalf("%+v", te)
+	}
+	if err.Error() != "invalid metadata: tensor \"b\" #1: invalid offset start: expected 1, got 2" {
+		t.Fatal(err)
+	}
+}
+
+func TestTensor_Validate_Error(t *testing.T) {
+	tensor := Tensor{Name: "a", DType: F32, Shape: []uint64{2}, Data: make([]byte, 7)}
+	if err := tensor.Validate(); !errors.Is(err, ErrShapeMismatch) {
+		t.Fatal(err)
+	}
+	// The number of elements wraps around to 0.
+	tensor = Tensor{Name: "a", DType: U8, Shape: []uint64{1 << 32, 1 << 32}}
+	if err := tensor.Validate(); !errors.Is(err, ErrOverflow) {
+		t.Fatal(err)
+	}
+	tensor = Tensor{Name: "a", DType: "F7"}
+	if err := tensor.Validate(); !errors.Is(err, ErrInvalidDType) {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package safetensors
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func FuzzParse(f *testing.F) {
+	f.Add(makeRaw(`{"test":{"dtype":"I32","shape":[2,2],"data_offsets":[0,16]},"__metadata__":{"foo":"bar"}}`, 16))
+	f.Add(makeRaw(`{"a":{"dtype":"U8","shape":[1],"data_offsets":[1,2]},"b":{"dtype":"U8","shape":[1],"data_offsets":[0,1]}}`, 2))
+	f.Add(makeRaw(`{"a":{"dtype":"BF16","shape":[],"data_offsets":[0,2]}}`, 2))
+	f.Fuzz(func(t *testing.T, b []byte) {
+		got, err := Parse(b)
+		strict, errStrict := ParseWithOptions(b, &ParseOptions{Strict: true})
+		if err != nil {
+			if errStrict == nil {
+				t.Fatal("strict mode accepted an invalid file")
+			}
+			return
+		}
+		if errStrict == nil {
+			if diff := cmp.Diff(got, strict); diff != "" {
+				t.Fatalf("(-lenient,+strict)\n%s", diff)
+			}
+		}
+		if err := got.ValidateTensors(context.Background(), nil); err != nil {
+			t.Fatal(err)
+		}
+		read, err := ReadContext(context.Background(), bytes.NewReader(b), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(got, read); diff != "" {
+			t.Fatalf("(-Parse,+ReadContext)\n%s", diff)
+		}
+	})
+}
+
+func FuzzHeader(f *testing.F) {
+	f.Add([]byte(`{"test":{"dtype":"I32","shape":[2,2],"data_offsets":[0,16]},"__metadata__":{"foo":"bar"}}`))
+	f.Add([]byte(`{"a":{"dtype":"U8","shape":null,"data_offsets":[0,1]}}`))
+	f.Add([]byte(`[]`))
+	f.Fuzz(func(t *testing.T, b []byte) {
+		for _, strict := range []bool{false, true} {
+			h := safeTensorsHeader{}
+			if err := h.decode(b, &ParseOptions{Strict: strict}); err != nil {
+				continue
+			}
+			if len(h.tensors) == 0 {
+				t.Fatal("no tensor")
+			}
+			end, err := h.validate()
+			if err != nil {
+				continue
+			}
+			for _, ti := range h.tensors {
+				if ti.DataOffsets[1] > end || ti.DataOffsets[0] > ti.DataOffsets[1] {
+					t.Fatalf("%+v", ti)
+				}
+				if ti.Shape == nil {
+					t.Fatal("nil shape")
+				}
+			}
+		}
+	})
+}
+
+func FuzzRoundTrip(f *testing.F) {
+	f.Add(makeRaw(`{"test":{"dtype":"I32","shape":[2,2],"data_offsets":[0,16]},"__metadata__":{"foo":"bar"}}`, 16))
+	f.Add(makeRaw(`{"aé":{"dtype":"U8","shape":[0],"data_offsets":[0,0]},"__metadata__":{}}`, 0))
+	f.Fuzz(func(t *testing.T, b []byte) {
+		want, err := Parse(b)
+		if err != nil {
+			return
+		}
+		buf := bytes.Buffer{}
+		if err := want.Serialize(&buf); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ParseWithOptions(buf.Bytes(), &ParseOptions{Strict: !hasDuplicates(want)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(want, got, cmpopts.EquateEmpty()); diff != "" {
+			t.Fatalf("(-want,+got)\n%s", diff)
+		}
+
+		lossless := &ParseOptions{Lossless: true}
+		if want, err = ParseWithOptions(b, lossless); err != nil {
+			t.Fatal(err)
+		}
+		buf.Reset()
+		if err := want.Serialize(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if got, err = ParseWithOptions(buf.Bytes(), lossless); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(want, got, cmpopts.EquateEmpty()); diff != "" {
+			t.Fatalf("(-want,+got)\n%s", diff)
+		}
+	})
+}
+
+func hasDuplicates(f *File) bool {
+	seen := map[string]bool{}
+	for _, t := range f.Tensors {
+		if seen[t.Name] {
+			return true
+		}
+		seen[t.Name] = true
+	}
+	return false
+}
@@ -9,6 +9,6 @@ go 1.23.3
 require (
 	github.com/edsrzf/mmap-go v1.2.0
 	github.com/google/go-cmp v0.6.0
+	github.com/klauspost/compress v1.18.0
+	golang.org/x/sys v0.27.0
 )
-
-require golang.org/x/sys v0.27.0 // indirect
@@ -0,0 +1,256 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package safetensors
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// HTTPOptions controls HTTPReader.
+type HTTPOptions struct {
+	// Client is the HTTP client to use. Defaults to http.DefaultClient.
+	Client *http.Client
+	// Header is added to each request, e.g. for "Authorization".
+	Header http.Header
+	// BlockSize is the granularity of the requests and of the cache. Defaults
+	// to 1 MiB.
+	BlockSize int64
+	// CacheBlocks is the maximum number of blocks kept in memory. Defaults to
+	// 64. The least recently used blocks are evicted first.
+	CacheBlocks int
+}
+
+// HTTPReader is an io.ReaderAt reading a remote file with HTTP Range requests.
+//
+// Reads are rounded to blocks which are cached. The missing adjacent blocks of
+// a single read are fetched with a single request. It is safe for concurrent
+// use.
+//
+// Use it with OpenLazy to read the header and the tensors individually without
+// downloading the whole file.
+type HTTPReader struct {
+	url    string
+	client *http.Client
+	header http.Header
+	bs     int64
+	max    int
+	size   int64
+	// etag and lastModified identify the version of the remote file returned by
+	// the first request.
+	etag         string
+	lastModified string
+
+	mu    sync.Mutex
+	lru   list.List
+	cache map[int64]*list.Element
+}
+
+type httpBlock struct {
+	index int64
+	data  []byte
+}
+
+// NewHTTPReader returns a reader for the file at url.
+//
+// It fetches the first block to determine the file size. The server must
+// support Range requests.
+//
+// The following requests are conditional on the ETag, or else Last-Modified,
+// of the first response so a file replaced on the server while the reader is
+// in use is reported as an error instead of mixing both versions.
+func NewHTTPReader(ctx context.Context, url string, opts *HTTPOptions) (*HTTPReader, error) {
+	if opts == nil {
+		opts = &HTTPOptions{}
+	}
+	h := &HTTPReader{
+		url:    url,
+		client: opts.Client,
+		header: opts.Header,
+		bs:     opts.BlockSize,
+		max:    opts.CacheBlocks,
+		size:   -1,
+		cache:  map[int64]*list.Element{},
+	}
+	if h.client == nil {
+		h.client = http.DefaultClient
+	}
+	if h.bs <= 0 {
+		h.bs = 1 << 20
+	}
+	if h.max <= 0 {
+		h.max = 64
+	}
+	b, err := h.fetch(ctx, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	h.store(0, b)
+	return h, nil
+}
+
+// Size returns the size of the remote file.
+func (h *HTTPReader) Size() int64 {
+	return h.size
+}
+
+// ReadAt implements io.ReaderAt.
+func (h *HTTPReader) ReadAt(p []byte, off int64) (int, error) {
+	return h.ReadAtContext(context.Background(), p, off)
+}
+
+// ReadAtContext is ReadAt with a context to cancel the HTTP requests.
+func (h *HTTPReader) ReadAtContext(ctx context.Context, p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if off >= h.size {
+		return 0, io.EOF
+	}
+	end := min(off+int64(len(p)), h.size)
+	first, last := off/h.bs, (end-1)/h.bs
+	blocks := make([][]byte, last-first+1)
+	h.mu.Lock()
+	for i := range blocks {
+		if e, ok := h.cache[first+int64(i)]; ok {
+			h.lru.MoveToFront(e)
+			blocks[i] = e.Value.(*httpBlock).data
+		}
+	}
+	h.mu.Unlock()
+	// Coalesce runs of missing blocks into a single request each.
+	for i := 0; i < len(blocks); {
+		if blocks[i] != nil {
+			i++
+			continue
+		}
+		j := i
+		for j+1 < len(blocks) && blocks[j+1] == nil {
+			j++
+		}
+		b, err := h.fetch(ctx, first+int64(i), first+int64(j))
+		if err != nil {
+			return 0, err
+		}
+		for k := i; k <= j; k++ {
+			blocks[k] = b[:min(h.bs, int64(len(b)))]
+			b = b[len(blocks[k]):]
+			h.store(first+int64(k), blocks[k])
+		}
+		i = j + 1
+	}
+	n := 0
+	start := off - first*h.bs
+	for _, b := range blocks {
+		n += copy(p[n:], b[start:])
+		start = 0
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// fetch requests the blocks first to last inclusively.
+func (h *HTTPReader) fetch(ctx context.Context, first, last int64) ([]byte, error) {
+	start, end := first*h.bs, (last+1)*h.bs
+	if h.size >= 0 {
+		end = min(end, h.size)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range h.header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end-1))
+	// If-Range only accepts a strong ETag.
+	if h.etag != "" && !strings.HasPrefix(h.etag, "W/") {
+		req.Header.Set("If-Range", h.etag)
+	} else if h.lastModified != "" {
+		req.Header.Set("If-Range", h.lastModified)
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if h.size == -1 {
+		h.etag = resp.Header.Get("ETag")
+		h.lastModified = resp.Header.Get("Last-Modified")
+	} else if (h.etag != "" || h.lastModified != "") && resp.StatusCode == http.StatusOK {
+		return nil, fmt.Errorf("%s: remote file changed", h.url)
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		return nil, fmt.Errorf("%s: range request failed: %s", h.url, resp.Status)
+	}
+	rs, re, size, err := parseContentRange(resp.Header.Get("Content-Range"))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", h.url, err)
+	}
+	if h.size == -1 {
+		h.size = size
+		end = min(end, size)
+	}
+	if e := resp.Header.Get("ETag"); e != h.etag {
+		return nil, fmt.Errorf("%s: remote file changed: ETag %q != %q", h.url, e, h.etag)
+	}
+	if l := resp.Header.Get("Last-Modified"); l != h.lastModified {
+		return nil, fmt.Errorf("%s: remote file changed: Last-Modified %q != %q", h.url, l, h.lastModified)
+	}
+	if rs != start || re != end-1 || size != h.size {
+		return nil, fmt.Errorf("%s: unexpected Content-Range %q", h.url, resp.Header.Get("Content-Range"))
+	}
+	b := make([]byte, end-start)
+	if _, err := io.ReadFull(resp.Body, b); err != nil {
+		return nil, fmt.Errorf("%s: %w", h.url, err)
+	}
+	return b, nil
+}
+
+// store adds a block to the cache, evicting the least recently used blocks.
+func (h *HTTPReader) store(index int64, data []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if e, ok := h.cache[index]; ok {
+		h.lru.MoveToFront(e)
+		return
+	}
+	h.cache[index] = h.lru.PushFront(&httpBlock{index: index, data: data})
+	for h.lru.Len() > h.max {
+		e := h.lru.Back()
+		h.lru.Remove(e)
+		delete(h.cache, e.Value.(*httpBlock).index)
+	}
+}
+
+// parseContentRange parses "bytes start-end/size".
+func parseContentRange(s string) (int64, int64, int64, error) {
+	v, ok := strings.CutPrefix(s, "bytes ")
+	if ok {
+		r, size, ok1 := strings.Cut(v, "/")
+		start, end, ok2 := strings.Cut(r, "-")
+		if ok1 && ok2 {
+			a, err1 := strconv.ParseInt(start, 10, 64)
+			b, err2 := strconv.ParseInt(end, 10, 64)
+			c, err3 := strconv.ParseInt(size, 10, 64)
+			if err1 == nil && err2 == nil && err3 == nil && a <= b && b < c {
+				return a, b, c, nil
+			}
+		}
+	}
+	return 0, 0, 0, fmt.Errorf("invalid Content-Range %q", s)
+}
@@ -0,0 +1,177 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package safetensors
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func serveBytes(t *testing.T, b []byte) (*httptest.Server, *atomic.Int32) {
+	var requests atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.ServeContent(w, r, "x.safetensors", time.Time{}, bytes.NewReader(b))
+	}))
+	t.Cleanup(s.Close)
+	return s, &requests
+}
+
+func TestHTTPReader(t *testing.T) {
+	b := make([]byte, 1000)
+	for i := range b {
+		b[i] = byte(i)
+	}
+	s, requests := serveBytes(t, b)
+	h, err := NewHTTPReader(context.Background(), s.URL, &HTTPOptions{BlockSize: 100, CacheBlocks: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Size() != 1000 {
+		t.Fatal(h.Size())
+	}
+	data := []struct {
+		off      int64
+		n        int
+		requests int32
+	}{
+		// Cached by NewHTTPReader.
+		{10, 50, 1},
+		// Blocks 2 to 4 are coalesced.
+		{250, 200, 2},
+		// Cached.
+		{300, 10, 2},
+		// Only block 1 is missing.
+		{50, 300, 3},
+		// Past the end.
+		{950, 100, 4},
+	}
+	for i, line := range data {
+		p := make([]byte, line.n)
+		n, err := h.ReadAt(p, line.off)
+		want := b[line.off:min(line.off+int64(line.n), 1000)]
+		if n != len(want) || (n == line.n && err != nil) || (n < line.n && err != io.EOF) {
+			t.Fatalf("#%d: %d, %v", i, n, err)
+		}
+		if !bytes.Equal(want, p[:n]) {
+			t.Fatalf("#%d: data mismatch", i)
+		}
+		if got := requests.Load(); got != line.requests {
+			t.Fatalf("#%d: requests %d != %d", i, got, line.requests)
+		}
+	}
+	if _, err := h.ReadAt(make([]byte, 1), 1000); err != io.EOF {
+		t.Fatal(err)
+	}
+	if n, err := h.ReadAt(nil, 1000); n != 0 || err != nil {
+		t.Fatal(n, err)
+	}
+}
+
+func TestHTTPReader_Lazy(t *testing.T) {
+	f := makeTestFile(100)
+	buf := bytes.Buffer{}
+	if err := f.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	s, requests := serveBytes(t, buf.Bytes())
+	h, err := NewHTTPReader(context.Background(), s.URL, &HTTPOptions{BlockSize: 4096})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := OpenLazy(h, h.Size(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Load("t42"); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(f.Tensors[42], l.Tensors[42]); diff != "" {
+		t.Fatalf("(-want,+got)\n%s", diff)
+	}
+	if got := requests.Load(); got > 2 {
+		t.Fatal(got)
+	}
+}
+
+func TestHTTPReader_ZeroSizedLast(t *testing.T) {
+	f := &File{Tensors: []Tensor{
+		{Name: "a", DType: U8, Shape: []uint64{1}, Data: []byte{1}},
+		{Name: "b", DType: U8, Shape: []uint64{0}, Data: []byte{}},
+	}}
+	buf := bytes.Buffer{}
+	if err := f.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	s, _ := serveBytes(t, buf.Bytes())
+	h, err := NewHTTPReader(context.Background(), s.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := OpenLazy(h, h.Size(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(f, l.File); diff != "" {
+		t.Fatalf("(-want,+got)\n%s", diff)
+	}
+}
+
+func TestHTTPReader_NoRange(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("hello"))
+	}))
+	defer s.Close()
+	if _, err := NewHTTPReader(context.Background(), s.URL, nil); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestHTTPReader_Changed(t *testing.T) {
+	b := make([]byte, 1000)
+	var etag atomic.Value
+	etag.Store(`"v1"`)
+	ignoreIfRange := false
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", etag.Load().(string))
+		if ignoreIfRange {
+			r.Header.Del("If-Range")
+		}
+		http.ServeContent(w, r, "x.safetensors", time.Time{}, bytes.NewReader(b))
+	}))
+	defer s.Close()
+	h, err := NewHTTPReader(context.Background(), s.URL, &HTTPOptions{BlockSize: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.ReadAt(make([]byte, 10), 100); err != nil {
+		t.Fatal(err)
+	}
+	// Replaced by a file of the same size.
+	etag.Store(`"v2"`)
+	if _, err := h.ReadAt(make([]byte, 10), 200); err == nil || err.Error() != s.URL+": remote file changed" {
+		t.Fatal(err)
+	}
+	// A server not supporting If-Range.
+	ignoreIfRange = true
+	if _, err := h.ReadAt(make([]byte, 10), 300); err == nil || err.Error() != s.URL+`: remote file changed: ETag "\"v2\"" != "\"v1\""` {
+		t.Fatal(err)
+	}
+	// Cached blocks are still readable.
+	if _, err := h.ReadAt(make([]byte, 10), 100); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package safetensors
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// HubCacheDir returns the local Hugging Face hub cache directory.
+//
+// It is $HF_HUB_CACHE, else $HF_HOME/hub, else
+// $XDG_CACHE_HOME/huggingface/hub, else ~/.cache/huggingface/hub.
+func HubCacheDir() (string, error) {
+	if d := os.Getenv("HF_HUB_CACHE"); d != "" {
+		return d, nil
+	}
+	if d := os.Getenv("HF_HOME"); d != "" {
+		return filepath.Join(d, "hub"), nil
+	}
+	if d := os.Getenv("XDG_CACHE_HOME"); d != "" {
+		return filepath.Join(d, "huggingface", "hub"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".cache", "huggingface", "hub"), nil
+}
+
+// ResolveHub returns the snapshot directory of the model repo, e.g.
+// "org/name" or "gpt2", at revision in the local Hugging Face hub cache.
+//
+// revision is either a ref name, like "main" or "refs/pr/1", or a commit hash.
+// It defaults to "main". The network is never accessed.
+func ResolveHub(repo, revision string) (string, error) {
+	cache, err := HubCacheDir()
+	if err != nil {
+		return "", err
+	}
+	// Canonical models like "gpt2" have no org.
+	parts := strings.Split(repo, "/")
+	if len(parts) > 2 || slices.ContainsFunc(parts, func(p string) bool {
+		return p == "" || p == "." || p == ".." || strings.Contains(p, `\`)
+	}) {
+		return "", fmt.Errorf("invalid repo id %q", repo)
+	}
+	if revision == "" {
+		revision = "main"
+	}
+	if strings.Contains(revision, "..") {
+		return "", fmt.Errorf("invalid revision %q", revision)
+	}
+	root := filepath.Join(cache, "models--"+strings.Join(parts, "--"))
+	ref := strings.TrimPrefix(revision, "refs/")
+	if b, err := os.ReadFile(filepath.Join(root, "refs", filepath.FromSlash(ref))); err == nil {
+		revision = strings.TrimSpace(string(b))
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+	dir := filepath.Join(root, "snapshots", revision)
+	if fi, err := os.Stat(dir); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", fmt.Errorf("%s@%s not found in %s", repo, revision, cache)
+		}
+		return "", err
+	} else if !fi.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", dir)
+	}
+	return dir, nil
+}
+
+// Sharded is a set of memory mapped safetensors files forming a single model.
+type Sharded struct {
+	// Files are the mapped files, in the order of Names.
+	Files []*Mapped
+	// Names are the files' names relative to the directory.
+	Names []string
+	// WeightMap maps each tensor name to its index in Files.
+	WeightMap map[string]int
+}
+
+// OpenHub opens the safetensors files of the model repo at revision from the
+// local Hugging Face hub cache. See ResolveHub and OpenSharded.
+func OpenHub(repo, revision string) (*Sharded, error) {
+	dir, err := ResolveHub(repo, revision)
+	if err != nil {
+		return nil, err
+	}
+	return OpenSharded(dir)
+}
+
+// shardIndex is the content of a "model.safetensors.index.json" file.
+type shardIndex struct {
+	WeightMap map[string]string `json:"weight_map"`
+}
+
+// OpenSharded memory maps the safetensors files of a model in dir.
+//
+// When "model.safetensors.index.json" is present, the shards it references are
+// opened. Otherwise all the ".safetensors" files in dir are opened.
+func OpenSharded(dir string) (*Sharded, error) {
+	var idx shardIndex
+	var names []string
+	if b, err := os.ReadFile(filepath.Join(dir, "model.safetensors.index.json")); err == nil {
+		if err := json.Unmarshal(b, &idx); err != nil {
+			return nil, fmt.Errorf("model.safetensors.index.json: %w", err)
+		}
+		for _, n := range idx.WeightMap {
+			if !slices.Contains(names, n) {
+				names = append(names, n)
+			}
+		}
+	} else if errors.Is(err, fs.ErrNotExist) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			// The hub cache uses symlinks to the blobs.
+			if !e.IsDir() && strings.HasSuffix(e.Name(), ".safetensors") {
+				names = append(names, e.Name())
+			}
+		}
+	} else {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no safetensors file found in %s", dir)
+	}
+	slices.Sort(names)
+	s := &Sharded{Names: names, WeightMap: map[string]int{}}
+	for i, n := range names {
+		if filepath.IsAbs(n) || !filepath.IsLocal(n) {
+			_ = s.Close()
+			return nil, fmt.Errorf("invalid shard name %q", n)
+		}
+		m := &Mapped{}
+		if err := m.Open(filepath.Join(dir, n)); err != nil {
+			_ = s.Close()
+			return nil, fmt.Errorf("%s: %w", n, err)
+		}
+		s.Files = append(s.Files, m)
+		for _, t := range m.Tensors {
+			if _, ok := s.WeightMap[t.Name]; ok {
+				_ = s.Close()
+				return nil, fmt.Errorf("%s: %w", n, errorf(ErrDuplicateName, "duplicate tensor name %q", t.Name))
+			}
+			s.WeightMap[t.Name] = i
+		}
+	}
+	for t, n := range idx.WeightMap {
+		if i, ok := s.WeightMap[t]; !ok || s.Names[i] != n {
+			_ = s.Close()
+			return nil, fmt.Errorf("tensor %q not found in %s", t, n)
+		}
+	}
+	return s, nil
+}
+
+// Tensor returns the named tensor.
+func (s *Sharded) Tensor(name string) (*Tensor, error) {
+	i, ok := s.WeightMap[name]
+	if !ok {
+		return nil, fmt.Errorf("tensor %q not found", name)
+	}
+	f := s.Files[i]
+	j := slices.IndexFunc(f.Tensors, func(t Tensor) bool { return t.Name == name })
+	return &f.Tensors[j], nil
+}
+
+// Close unmaps all the files.
+func (s *Sharded) Close() error {
+	var errs []error
+	for _, m := range s.Files {
+		errs = append(errs, m.Close())
+	}
+	s.Files = nil
+	return errors.Join(errs...)
+}
@@ -0,0 +1,128 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package safetensors
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestHubCacheDir(t *testing.T) {
+	t.Setenv("HF_HUB_CACHE", "")
+	t.Setenv("HF_HOME", "/hf")
+	if d, err := HubCacheDir(); err != nil || d != filepath.Join("/hf", "hub") {
+		t.Fatal(d, err)
+	}
+	t.Setenv("HF_HUB_CACHE", "/cache")
+	if d, err := HubCacheDir(); err != nil || d != "/cache" {
+		t.Fatal(d, err)
+	}
+}
+
+func TestOpenHub(t *testing.T) {
+	cache := t.TempDir()
+	t.Setenv("HF_HUB_CACHE", cache)
+	root := filepath.Join(cache, "models--org--name")
+	snap := filepath.Join(root, "snapshots", "abc123")
+	if err := os.MkdirAll(snap, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(root, "refs"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "refs", "main"), []byte("abc123"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	f := makeTestFile(4)
+	a := &File{Tensors: f.Tensors[:2]}
+	b := &File{Tensors: f.Tensors[2:]}
+	if err := WriteFile(filepath.Join(snap, "model-00001-of-00002.safetensors"), a, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(filepath.Join(snap, "model-00002-of-00002.safetensors"), b, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without index.
+	for _, rev := range []string{"", "main", "refs/main", "abc123"} {
+		s, err := OpenHub("org/name", rev)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]int{"t0": 0, "t1": 0, "t2": 1, "t3": 1}
+		if diff := cmp.Diff(want, s.WeightMap); diff != "" {
+			t.Fatalf("(-want,+got)\n%s", diff)
+		}
+		if err := s.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// With index.
+	idx := `{"metadata":{"total_size":32},"weight_map":{"t0":"model-00001-of-00002.safetensors","t3":"model-00002-of-00002.safetensors"}}`
+	if err := os.WriteFile(filepath.Join(snap, "model.safetensors.index.json"), []byte(idx), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	s, err := OpenHub("org/name", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tensor, err := s.Tensor("t3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(f.Tensors[3], *tensor); diff != "" {
+		t.Fatalf("(-want,+got)\n%s", diff)
+	}
+	if _, err := s.Tensor("missing"); err == nil {
+		t.Fatal("expected error")
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	idx = `{"weight_map":{"t0":"model-00002-of-00002.safetensors"}}`
+	if err := os.WriteFile(filepath.Join(snap, "model.safetensors.index.json"), []byte(idx), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenHub("org/name", ""); err == nil {
+		t.Fatal("expected error")
+	}
+	for _, repo := range []string{"name", "org/../name", "../x"} {
+		if _, err := OpenHub(repo, ""); err == nil {
+			t.Fatalf("%q: expected error", repo)
+		}
+	}
+	if _, err := OpenHub("org/name", "other"); err == nil {
+		t.Fatal("expected error")
+	}
+
+	// Repo without org.
+	snap = filepath.Join(cache, "models--gpt2", "snapshots", "def456")
+	if err := os.MkdirAll(snap, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(filepath.Join(snap, "model.safetensors"), a, nil); err != nil {
+		t.Fatal(err)
+	}
+	s, err = OpenHub("gpt2", "def456")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(map[string]int{"t0": 0, "t1": 0}, s.WeightMap); diff != "" {
+		t.Fatalf("(-want,+got)\n%s", diff)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, repo := range []string{"", "..", "a/b/c", `a\b`, "/gpt2"} {
+		if _, err := ResolveHub(repo, ""); err == nil {
+			t.Fatalf("%q: expected error", repo)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package safetensors
+
+import (
+	"fmt"
+	"io"
+	"slices"
+)
+
+// Lazy is a safetensors file where only the header is read upfront and the
+// tensors' data is read on demand.
+//
+// Tensor.Data is nil until the tensor is loaded with Load.
+type Lazy struct {
+	*File
+	r io.ReaderAt
+	// offsets are the absolute offsets of each tensor's data in r.
+	offsets [][2]int64
+}
+
+// OpenLazy reads the header of the safetensors file of size bytes in r.
+//
+// r can be an *os.File, a *bytes.Reader or an *HTTPReader.
+func OpenLazy(r io.ReaderAt, size int64, opts *ParseOptions) (*Lazy, error) {
+	h := safeTensorsHeader{}
+	n, err := h.parseHeaderReader(io.NewSectionReader(r, 0, size), opts)
+	if err != nil {
+		return nil, fmt.Errorf("invalid header: %w", err)
+	}
+	bufferEnd, err := h.validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid metadata: %w", err)
+	}
+	if err := opts.checkDataSize(bufferEnd); err != nil {
+		return nil, err
+	}
+	if err := checkSize(n+8+bufferEnd, uint64(size)); err != nil {
+		return nil, err
+	}
+	l := &Lazy{
+		File:    &File{Metadata: h.metadata, RawMetadata: h.rawMetadata, Tensors: make([]Tensor, len(h.tensors))},
+		r:       r,
+		offsets: make([][2]int64, len(h.tensors)),
+	}
+	for i := range h.tensors {
+		h.tensors[i].toTensor(&l.Tensors[i], nil)
+		l.offsets[i][0] = int64(n + 8 + h.tensors[i].DataOffsets[0])
+		l.offsets[i][1] = int64(n + 8 + h.tensors[i].DataOffsets[1])
+	}
+	return l, nil
+}
+
+// Reader returns a reader for the named tensor's data.
+func (l *Lazy) Reader(name string) (*io.SectionReader, error) {
+	i, err := l.index(name)
+	if err != nil {
+		return nil, err
+	}
+	return io.NewSectionReader(l.r, l.offsets[i][0], l.offsets[i][1]-l.offsets[i][0]), nil
+}
+
+// Load reads the named tensors' data into Tensor.Data. When no name is
+// specified, all the tensors are loaded. Tensors already loaded are skipped.
+func (l *Lazy) Load(names ...string) error {
+	var indexes []int
+	if len(names) == 0 {
+		for i := range l.Tensors {
+			indexes = append(indexes, i)
+		}
+	} else {
+		for _, name := range names {
+			i, err := l.index(name)
+			if err != nil {
+				return err
+			}
+			indexes = append(indexes, i)
+		}
+	}
+	for _, i := range indexes {
+		t := &l.Tensors[i]
+		if t.Data != nil {
+			continue
+		}
+		d := make([]byte, l.offsets[i][1]-l.offsets[i][0])
+		// Skip zero-sized tensors, they may be at the end of the file.
+		if len(d) != 0 {
+			if _, err := l.r.ReadAt(d, l.offsets[i][0]); err != nil {
+				return &TensorError{Name: t.Name, Index: i, Err: errorf(ErrTruncated, "read error: %w", err)}
+			}
+		}
+		t.Data = d
+		if err := t.Validate(); err != nil {
+			t.Data = nil
+			return &TensorError{Name: t.Name, Index: i, Err: err}
+		}
+	}
+	return nil
+}
+
+func (l *Lazy) index(name string) (int, error) {
+	i := slices.IndexFunc(l.Tensors, func(t Tensor) bool { return t.Name == name })
+	if i == -1 {
+		return 0, fmt.Errorf("tensor %q not found", name)
+	}
+	return i, nil
+}
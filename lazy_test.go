@@ -0,0 +1,84 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package safetensors
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestOpenLazy(t *testing.T) {
+	f := makeTestFile(10)
+	f.Metadata = map[string]string{"a": "b"}
+	buf := bytes.Buffer{}
+	if err := f.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	l, err := OpenLazy(bytes.NewReader(buf.Bytes()), int64(buf.Len()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(f.Metadata, l.Metadata); diff != "" {
+		t.Fatalf("(-want,+got)\n%s", diff)
+	}
+	for i := range l.Tensors {
+		if l.Tensors[i].Data != nil {
+			t.Fatal("expected lazy")
+		}
+	}
+	if err := l.Load("t3"); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(f.Tensors[3], l.Tensors[3]); diff != "" {
+		t.Fatalf("(-want,+got)\n%s", diff)
+	}
+	if l.Tensors[4].Data != nil {
+		t.Fatal("expected lazy")
+	}
+	r, err := l.Reader("t5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := io.ReadAll(r); err != nil || !bytes.Equal(b, f.Tensors[5].Data) {
+		t.Fatal(b, err)
+	}
+	if err := l.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(f, l.File); diff != "" {
+		t.Fatalf("(-want,+got)\n%s", diff)
+	}
+	if err := l.Load("missing"); err == nil {
+		t.Fatal("expected error")
+	}
+	if _, err := OpenLazy(bytes.NewReader(buf.Bytes()), int64(buf.Len()-1), nil); !errors.Is(err, ErrTruncated) {
+		t.Fatal(err)
+	}
+}
+
+func TestOpenLazy_ZeroSizedLast(t *testing.T) {
+	f := &File{Tensors: []Tensor{
+		{Name: "a", DType: U8, Shape: []uint64{1}, Data: []byte{1}},
+		{Name: "b", DType: U8, Shape: []uint64{0}, Data: []byte{}},
+	}}
+	buf := bytes.Buffer{}
+	if err := f.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	l, err := OpenLazy(bytes.NewReader(buf.Bytes()), int64(buf.Len()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(f, l.File); diff != "" {
+		t.Fatalf("(-want,+got)\n%s", diff)
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package safetensors
+
+// All the methods accept a nil receiver, meaning the default limits.
+
+func (o *ParseOptions) maxHeaderSize() uint64 {
+	if o == nil || o.MaxHeaderSize == 0 {
+		return maxHeaderSize
+	}
+	return o.MaxHeaderSize
+}
+
+func (o *ParseOptions) checkTensors(n int) error {
+	if o != nil && o.MaxTensors > 0 && n > o.MaxTensors {
+		return errorf(ErrLimitExceeded, "too many tensors: max %d", o.MaxTensors)
+	}
+	return nil
+}
+
+func (o *ParseOptions) checkRank(n int) error {
+	if o != nil && o.MaxRank > 0 && n > o.MaxRank {
+		return errorf(ErrLimitExceeded, "rank too large: max %d, actual %d", o.MaxRank, n)
+	}
+	return nil
+}
+
+func (o *ParseOptions) checkMetadata(m map[string]string) error {
+	if o == nil {
+		return nil
+	}
+	if o.MaxMetadataEntries > 0 && len(m) > o.MaxMetadataEntries {
+		return errorf(ErrLimitExceeded, "too many metadata entries: max %d, actual %d", o.MaxMetadataEntries, len(m))
+	}
+	if o.MaxMetadataValueLen > 0 {
+		for k, v := range m {
+			if len(k) > o.MaxMetadataValueLen || len(v) > o.MaxMetadataValueLen {
+				return errorf(ErrLimitExceeded, "metadata %q too long: max %d", k, o.MaxMetadataValueLen)
+			}
+		}
+	}
+	return nil
+}
+
+func (o *ParseOptions) checkDataSize(n uint64) error {
+	if o != nil && o.MaxDataSize > 0 && n > o.MaxDataSize {
+		return errorf(ErrLimitExceeded, "data too large: max %d, actual %d", o.MaxDataSize, n)
+	}
+	return nil
+}
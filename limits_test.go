@@ -0,0 +1,48 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package safetensors
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func TestParse_Limits(t *testing.T) {
+	d := makeRaw(`{"__metadata__":{"k":"value","k2":"v"},"a":{"dtype":"U8","shape":[1,1,1],"data_offsets":[0,1]},"b":{"dtype":"U8","shape":[2],"data_offsets":[1,3]}}`, 3)
+	data := []struct {
+		opts ParseOptions
+		err  string
+		kind error
+	}{
+		{ParseOptions{MaxHeaderSize: 10}, "invalid header: too large max 10, actual 147", ErrHeaderTooLarge},
+		{ParseOptions{MaxTensors: 1}, "invalid header: too many tensors: max 1", ErrLimitExceeded},
+		{ParseOptions{MaxRank: 2}, "invalid header: tensor \"a\" #0: rank too large: max 2, actual 3", ErrLimitExceeded},
+		{ParseOptions{MaxMetadataEntries: 1}, "invalid header: too many metadata entries: max 1, actual 2", ErrLimitExceeded},
+		{ParseOptions{MaxMetadataValueLen: 4}, "invalid header: metadata \"k\" too long: max 4", ErrLimitExceeded},
+		{ParseOptions{MaxDataSize: 2}, "data too large: max 2, actual 3", ErrLimitExceeded},
+	}
+	for i, line := range data {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			_, err := ParseWithOptions(d, &line.opts)
+			if err == nil || err.Error() != line.err {
+				t.Fatalf("Invalid error\nwant: %s\ngot:  %s", line.err, err)
+			}
+			if !errors.Is(err, line.kind) {
+				t.Fatal(err)
+			}
+			_, err = ReadContext(context.Background(), bytes.NewReader(d), &LoadOptions{ParseOptions: line.opts})
+			if !errors.Is(err, line.kind) {
+				t.Fatal(err)
+			}
+		})
+	}
+	opts := ParseOptions{MaxHeaderSize: 147, MaxTensors: 2, MaxRank: 3, MaxMetadataEntries: 2, MaxMetadataValueLen: 5, MaxDataSize: 3}
+	if _, err := ParseWithOptions(d, &opts); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,216 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package safetensors
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+)
+
+// LoRAConfig is the subset of a PEFT "adapter_config.json" used to merge a
+// LoRA adapter.
+type LoRAConfig struct {
+	// R is the default rank. The actual rank is read from the lora_A tensors.
+	R int `json:"r"`
+	// Alpha is the default scaling numerator.
+	Alpha float64 `json:"lora_alpha"`
+	// AlphaPattern overrides Alpha for the modules whose name ends with the
+	// key.
+	AlphaPattern map[string]float64 `json:"alpha_pattern"`
+	// UseRSLoRA scales by alpha/sqrt(r) instead of alpha/r.
+	UseRSLoRA bool `json:"use_rslora"`
+	// FanInFanOut is set when the base weights are stored as (in, out), like
+	// GPT-2's Conv1D.
+	FanInFanOut bool `json:"fan_in_fan_out"`
+}
+
+// ReadLoRAConfig reads a PEFT "adapter_config.json" file.
+func ReadLoRAConfig(name string) (*LoRAConfig, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	c := &LoRAConfig{}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return c, nil
+}
+
+// scale returns the scaling factor of the module with rank r.
+func (c *LoRAConfig) scale(module string, r int) float32 {
+	alpha := c.Alpha
+	best := -1
+	for k, v := range c.AlphaPattern {
+		if (module == k || strings.HasSuffix(module, "."+k)) && len(k) > best {
+			alpha, best = v, len(k)
+		}
+	}
+	if c.UseRSLoRA {
+		return float32(alpha / math.Sqrt(float64(r)))
+	}
+	return float32(alpha / float64(r))
+}
+
+// MergeLoRA returns a File where the LoRA adapter is merged into the base
+// weights: W' = W + scale·B·A, where scale is alpha/r.
+//
+// The adapter's tensors are named like PEFT saves them, e.g.
+// "base_model.model.<module>.lora_A.weight" of shape (r, in) and
+// "base_model.model.<module>.lora_B.weight" of shape (out, r) for the base
+// weight "<module>.weight" of shape (out, in). Other adapter tensors, e.g.
+// from modules_to_save, replace the base tensor of the same name.
+//
+// The computation is done in F32 and the result is stored in the base
+// tensor's dtype. The tensors not modified are shared with base.
+func MergeLoRA(ctx context.Context, base, adapter *File, cfg *LoRAConfig, opts *ParallelOptions) (*File, error) {
+	return mergeLoRA(ctx, base, adapter, cfg, opts, 1)
+}
+
+// UnmergeLoRA reverts MergeLoRA: W = W' - scale·B·A.
+//
+// Due to the rounding to the base dtype, the result may not be bit exact.
+func UnmergeLoRA(ctx context.Context, merged, adapter *File, cfg *LoRAConfig, opts *ParallelOptions) (*File, error) {
+	return mergeLoRA(ctx, merged, adapter, cfg, opts, -1)
+}
+
+type loraPair struct {
+	a, b   *Tensor
+	module string
+}
+
+func mergeLoRA(ctx context.Context, base, adapter *File, cfg *LoRAConfig, opts *ParallelOptions, sign float32) (*File, error) {
+	if cfg == nil {
+		return nil, errors.New("missing LoRA config")
+	}
+	pairs := map[string]*loraPair{}
+	replace := map[string]*Tensor{}
+	for i := range adapter.Tensors {
+		t := &adapter.Tensors[i]
+		name := strings.TrimPrefix(t.Name, "base_model.model.")
+		if m, ok := strings.CutSuffix(name, ".lora_A.weight"); ok {
+			p := pairs[m+".weight"]
+			if p == nil {
+				p = &loraPair{module: m}
+				pairs[m+".weight"] = p
+			}
+			p.a = t
+		} else if m, ok := strings.CutSuffix(name, ".lora_B.weight"); ok {
+			p := pairs[m+".weight"]
+			if p == nil {
+				p = &loraPair{module: m}
+				pairs[m+".weight"] = p
+			}
+			p.b = t
+		} else {
+			replace[name] = t
+		}
+	}
+	for name, p := range pairs {
+		if p.a == nil || p.b == nil {
+			return nil, fmt.Errorf("module %q: incomplete LoRA pair", p.module)
+		}
+		if findTensor(base, name) == nil {
+			return nil, fmt.Errorf("module %q: base tensor %q not found", p.module, name)
+		}
+	}
+	for name := range replace {
+		if findTensor(base, name) == nil {
+			return nil, fmt.Errorf("adapter tensor %q not found in base", name)
+		}
+	}
+	out := &File{Tensors: make([]Tensor, len(base.Tensors)), Metadata: base.Metadata}
+	err := base.ForEach(ctx, opts, func(i int, t *Tensor) error {
+		if r, ok := replace[t.Name]; ok {
+			c, err := r.Cast(t.DType)
+			c.Name = t.Name
+			out.Tensors[i] = c
+			return err
+		}
+		p, ok := pairs[t.Name]
+		if !ok {
+			out.Tensors[i] = *t
+			return nil
+		}
+		var err error
+		out.Tensors[i], err = p.merge(t, cfg, sign)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// merge returns w + sign·scale·B·A in w's dtype.
+func (p *loraPair) merge(w *Tensor, cfg *LoRAConfig, sign float32) (Tensor, error) {
+	if !w.DType.IsFloat() || !p.a.DType.IsFloat() || !p.b.DType.IsFloat() {
+		return Tensor{}, errorf(ErrInvalidDType, "LoRA requires floating point tensors")
+	}
+	if len(w.Shape) != 2 || len(p.a.Shape) != 2 || len(p.b.Shape) != 2 {
+		return Tensor{}, errors.New("LoRA requires 2D tensors")
+	}
+	r, in, out := p.a.Shape[0], p.a.Shape[1], p.b.Shape[0]
+	if p.b.Shape[1] != r {
+		return Tensor{}, errorf(ErrShapeMismatch, "lora_A %v and lora_B %v ranks differ", p.a.Shape, p.b.Shape)
+	}
+	rows, cols := out, in
+	if cfg.FanInFanOut {
+		rows, cols = in, out
+	}
+	if w.Shape[0] != rows || w.Shape[1] != cols {
+		return Tensor{}, errorf(ErrShapeMismatch, "weight %v doesn't match lora_A %v and lora_B %v", w.Shape, p.a.Shape, p.b.Shape)
+	}
+	for _, t := range []*Tensor{w, p.a, p.b} {
+		if err := t.Validate(); err != nil {
+			return Tensor{}, err
+		}
+	}
+	a := toF32(p.a)
+	b := toF32(p.b)
+	m := toF32(w)
+	scale := sign * cfg.scale(p.module, int(r))
+	for i := range out {
+		for k := range r {
+			bik := scale * b[i*r+k]
+			if bik == 0 {
+				continue
+			}
+			row := a[k*in : (k+1)*in]
+			if cfg.FanInFanOut {
+				// m is (in, out): update column i.
+				for j, v := range row {
+					m[uint64(j)*out+i] += bik * v
+				}
+			} else {
+				dst := m[i*in : (i+1)*in]
+				for j, v := range row {
+					dst[j] += bik * v
+				}
+			}
+		}
+	}
+	res := Tensor{Name: w.Name, DType: w.DType, Shape: w.Shape, Data: make([]byte, len(w.Data))}
+	ws := w.DType.WordSize()
+	for i, v := range m {
+		w.DType.encode(res.Data[uint64(i)*ws:], float64(v))
+	}
+	return res, nil
+}
+
+// toF32 decodes the tensor's elements.
+func toF32(t *Tensor) []float32 {
+	ws := t.DType.WordSize()
+	out := make([]float32, uint64(len(t.Data))/ws)
+	for i := range out {
+		out[i] = float32(t.DType.decode(t.Data[uint64(i)*ws:]))
+	}
+	return out
+}
@@ -0,0 +1,138 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package safetensors
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func makeFloats(name string, dt DType, shape []uint64, values ...float64) Tensor {
+	t := Tensor{Name: name, DType: dt, Shape: shape, Data: make([]byte, uint64(len(values))*dt.WordSize())}
+	for i, v := range values {
+		dt.encode(t.Data[uint64(i)*dt.WordSize():], v)
+	}
+	return t
+}
+
+func decodeAll(t *Tensor) []float64 {
+	var out []float64
+	for i := uint64(0); i < uint64(len(t.Data)); i += t.DType.WordSize() {
+		out = append(out, t.DType.decode(t.Data[i:]))
+	}
+	return out
+}
+
+func TestMergeLoRA(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "adapter_config.json")
+	if err := os.WriteFile(cfgPath, []byte(`{"r":1,"lora_alpha":2,"alpha_pattern":{"k_proj":4},"target_modules":["q_proj","k_proj"]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := ReadLoRAConfig(cfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := &File{
+		Metadata: map[string]string{"format": "pt"},
+		Tensors: []Tensor{
+			makeFloats("model.q_proj.weight", F32, []uint64{2, 3}, 1, 2, 3, 4, 5, 6),
+			makeFloats("model.k_proj.weight", BF16, []uint64{2, 3}, 0, 0, 0, 0, 0, 0),
+			makeFloats("model.norm.weight", F32, []uint64{2}, 1, 1),
+			makeFloats("score.weight", F32, []uint64{1}, 0),
+		},
+	}
+	adapter := &File{
+		Tensors: []Tensor{
+			makeFloats("base_model.model.model.q_proj.lora_A.weight", F32, []uint64{1, 3}, 1, 0, -1),
+			makeFloats("base_model.model.model.q_proj.lora_B.weight", F32, []uint64{2, 1}, 1, 2),
+			makeFloats("base_model.model.model.k_proj.lora_A.weight", BF16, []uint64{1, 3}, 1, 2, 3),
+			makeFloats("base_model.model.model.k_proj.lora_B.weight", BF16, []uint64{2, 1}, 0.5, 1),
+			makeFloats("base_model.model.score.weight", F16, []uint64{1}, 7),
+		},
+	}
+	got, err := MergeLoRA(context.Background(), base, adapter, cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// q_proj: scale 2, B·A = [[1 0 -1] [2 0 -2]].
+	if diff := cmp.Diff([]float64{3, 2, 1, 8, 5, 2}, decodeAll(&got.Tensors[0])); diff != "" {
+		t.Fatalf("(-want,+got)\n%s", diff)
+	}
+	// k_proj: scale 4 from alpha_pattern, B·A = [[0.5 1 1.5] [1 2 3]].
+	if got.Tensors[1].DType != BF16 {
+		t.Fatal(got.Tensors[1].DType)
+	}
+	if diff := cmp.Diff([]float64{2, 4, 6, 4, 8, 12}, decodeAll(&got.Tensors[1])); diff != "" {
+		t.Fatalf("(-want,+got)\n%s", diff)
+	}
+	if diff := cmp.Diff(base.Tensors[2], got.Tensors[2]); diff != "" {
+		t.Fatalf("(-want,+got)\n%s", diff)
+	}
+	if got.Tensors[3].DType != F32 || got.Tensors[3].Name != "score.weight" || decodeAll(&got.Tensors[3])[0] != 7 {
+		t.Fatalf("%+v", got.Tensors[3])
+	}
+	// The base is not modified.
+	if decodeAll(&base.Tensors[0])[0] != 1 {
+		t.Fatal("base modified")
+	}
+
+	back, err := UnmergeLoRA(context.Background(), got, &File{Tensors: adapter.Tensors[:4]}, cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(base.Tensors[:2], back.Tensors[:2]); diff != "" {
+		t.Fatalf("(-want,+got)\n%s", diff)
+	}
+}
+
+func TestMergeLoRA_FanInFanOut(t *testing.T) {
+	base := &File{Tensors: []Tensor{makeFloats("c_attn.weight", F32, []uint64{3, 2}, 0, 0, 0, 0, 0, 0)}}
+	adapter := &File{
+		Tensors: []Tensor{
+			makeFloats("base_model.model.c_attn.lora_A.weight", F32, []uint64{1, 3}, 1, 2, 3),
+			makeFloats("base_model.model.c_attn.lora_B.weight", F32, []uint64{2, 1}, 1, 10),
+		},
+	}
+	got, err := MergeLoRA(context.Background(), base, adapter, &LoRAConfig{R: 1, Alpha: 1, FanInFanOut: true}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]float64{1, 10, 2, 20, 3, 30}, decodeAll(&got.Tensors[0])); diff != "" {
+		t.Fatalf("(-want,+got)\n%s", diff)
+	}
+}
+
+func TestMergeLoRA_Errors(t *testing.T) {
+	base := &File{Tensors: []Tensor{makeFloats("w.weight", F32, []uint64{2, 2}, 0, 0, 0, 0)}}
+	a := makeFloats("base_model.model.w.lora_A.weight", F32, []uint64{1, 2}, 1, 1)
+	b := makeFloats("base_model.model.w.lora_B.weight", F32, []uint64{2, 1}, 1, 1)
+	cfg := &LoRAConfig{R: 1, Alpha: 1}
+	ctx := context.Background()
+	data := []struct {
+		name    string
+		adapter File
+	}{
+		{"incomplete", File{Tensors: []Tensor{a}}},
+		{"missing", File{Tensors: []Tensor{makeFloats("base_model.model.x.lora_A.weight", F32, []uint64{1, 2}, 1, 1), b}}},
+		{"shape", File{Tensors: []Tensor{makeFloats("base_model.model.w.lora_A.weight", F32, []uint64{1, 3}, 1, 1, 1), b}}},
+		{"unknown", File{Tensors: []Tensor{a, b, makeFloats("other", F32, []uint64{1}, 1)}}},
+	}
+	for _, line := range data {
+		if _, err := MergeLoRA(ctx, base, &line.adapter, cfg, nil); err == nil {
+			t.Fatalf("%s: expected error", line.name)
+		} else if line.name == "shape" && !errors.Is(err, ErrShapeMismatch) {
+			t.Fatal(err)
+		}
+	}
+	if _, err := MergeLoRA(ctx, base, &File{Tensors: []Tensor{a, b}}, nil, nil); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package safetensors
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// RawField is a JSON object member kept verbatim, as found in the header.
+type RawField struct {
+	Key   string
+	Value json.RawMessage
+}
+
+// rawFields returns the members of the JSON object in raw in order. It
+// returns nil for null.
+func rawFields(raw json.RawMessage) ([]RawField, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if tok == nil {
+		return nil, nil
+	}
+	if tok != json.Delim('{') {
+		return nil, fmt.Errorf("invalid json; expected object, got %v", tok)
+	}
+	out := []RawField{}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		f := RawField{Key: key.(string)}
+		if err := dec.Decode(&f.Value); err != nil {
+			return nil, err
+		}
+		out = append(out, f)
+	}
+	return out, nil
+}
+
+// stringFields returns the fields that are JSON strings.
+func stringFields(fields []RawField) map[string]string {
+	var out map[string]string
+	for _, f := range fields {
+		var s string
+		if isJSONString(f.Value) && json.Unmarshal(f.Value, &s) == nil {
+			if out == nil {
+				out = map[string]string{}
+			}
+			out[f.Key] = s
+		}
+	}
+	return out
+}
+
+func isJSONString(v json.RawMessage) bool {
+	return len(v) != 0 && v[0] == '"'
+}
+
+// extraFields returns the fields that are not decoded in tensorInfo.
+//
+// encoding/json matches the field names case-insensitively.
+func extraFields(fields []RawField) []RawField {
+	var out []RawField
+	for _, f := range fields {
+		if !strings.EqualFold(f.Key, "dtype") && !strings.EqualFold(f.Key, "shape") && !strings.EqualFold(f.Key, "data_offsets") {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// mergeMetadata applies the string entries of m over raw.
+//
+// Non-string values in raw are kept. String values in raw are kept verbatim
+// when unchanged in m, updated when changed and dropped when missing from m.
+// New keys in m are appended in sorted order.
+func mergeMetadata(raw []RawField, m map[string]string) ([]RawField, error) {
+	out := make([]RawField, 0, len(raw)+len(m))
+	seen := map[string]struct{}{}
+	for _, f := range raw {
+		seen[f.Key] = struct{}{}
+		if !isJSONString(f.Value) {
+			out = append(out, f)
+			continue
+		}
+		v, ok := m[f.Key]
+		if !ok {
+			continue
+		}
+		var s string
+		if json.Unmarshal(f.Value, &s) == nil && s == v {
+			out = append(out, f)
+			continue
+		}
+		d, err := marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, RawField{Key: f.Key, Value: d})
+	}
+	for _, k := range slices.Sorted(maps.Keys(m)) {
+		if _, ok := seen[k]; ok {
+			continue
+		}
+		d, err := marshal(m[k])
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, RawField{Key: k, Value: d})
+	}
+	return out, nil
+}
+
+// appendFields appends the fields as JSON object members, each preceded by a
+// comma when sep is true.
+func appendFields(b []byte, fields []RawField, sep bool) ([]byte, error) {
+	for _, f := range fields {
+		if sep {
+			b = append(b, ',')
+		}
+		sep = true
+		k, err := marshal(f.Key)
+		if err != nil {
+			return nil, err
+		}
+		b = append(append(append(b, k...), ':'), f.Value...)
+	}
+	return b, nil
+}
+
+// marshal is json.Marshal without HTML escaping, like the reference
+// implementation.
+func marshal(v any) ([]byte, error) {
+	buf := bytes.Buffer{}
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte{'\n'}), nil
+}
@@ -0,0 +1,91 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package safetensors
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const losslessHeader = `{"__metadata__":{"z":"<&>","step":1000,"nested":{"a":[1,2]},"format":"pt"},` +
+	`"a":{"dtype":"U8","shape":[2],"data_offsets":[0,2],"quant":{"scale":0.5}},` +
+	`"b":{"dtype":"U8","shape":[],"data_offsets":[2,3]}}`
+
+func TestParse_Lossless(t *testing.T) {
+	in := bytes.Buffer{}
+	in.Write(makeRaw(losslessHeader, 3))
+	if _, err := Parse(in.Bytes()); err == nil {
+		t.Fatal("non-string metadata must be rejected by default")
+	}
+	f, err := ParseWithOptions(in.Bytes(), &ParseOptions{Lossless: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(map[string]string{"z": "<&>", "format": "pt"}, f.Metadata); diff != "" {
+		t.Fatalf("(-want,+got)\n%s", diff)
+	}
+	wantExtra := []RawField{{Key: "quant", Value: json.RawMessage(`{"scale":0.5}`)}}
+	if diff := cmp.Diff(wantExtra, f.Tensors[0].Extra); diff != "" {
+		t.Fatalf("(-want,+got)\n%s", diff)
+	}
+	out := bytes.Buffer{}
+	if err := f.Serialize(&out); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(in.String(), out.String()); diff != "" {
+		t.Fatalf("(-want,+got)\n%s", diff)
+	}
+
+	// String edits are applied over the raw metadata.
+	delete(f.Metadata, "z")
+	f.Metadata["format"] = "np"
+	f.Metadata["new"] = "1"
+	out.Reset()
+	if err := f.Serialize(&out); err != nil {
+		t.Fatal(err)
+	}
+	f2, err := ParseWithOptions(out.Bytes(), &ParseOptions{Lossless: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []RawField{
+		{Key: "step", Value: json.RawMessage(`1000`)},
+		{Key: "nested", Value: json.RawMessage(`{"a":[1,2]}`)},
+		{Key: "format", Value: json.RawMessage(`"np"`)},
+		{Key: "new", Value: json.RawMessage(`"1"`)},
+	}
+	if diff := cmp.Diff(want, f2.RawMetadata); diff != "" {
+		t.Fatalf("(-want,+got)\n%s", diff)
+	}
+}
+
+func TestEditMetadata_Lossless(t *testing.T) {
+	n := filepath.Join(t.TempDir(), "model.safetensors")
+	if err := os.WriteFile(n, makeRaw(losslessHeader+"     ", 3), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := EditMetadata(n, func(m map[string]string) { m["format"] = "x" }); err != nil {
+		t.Fatal(err)
+	}
+	d, err := os.ReadFile(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := ParseWithOptions(d, &ParseOptions{Lossless: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.RawMetadata) != 4 || string(f.RawMetadata[1].Value) != "1000" || f.Metadata["format"] != "x" {
+		t.Fatalf("%+v", f.RawMetadata)
+	}
+	if len(f.Tensors[0].Extra) != 1 {
+		t.Fatal(f.Tensors[0].Extra)
+	}
+}
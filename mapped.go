@@ -5,47 +5,257 @@
 package safetensors
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"io"
 	"os"
+	"slices"
+	"unsafe"
 
 	"github.com/edsrzf/mmap-go"
 )
 
-// Mapped is a read-only memory mapped SafeTensors file.
+// Mapped is a memory mapped SafeTensors file.
 //
 // This is the fastest way to use a safetensors file.
 type Mapped struct {
 	*File
-	f io.Closer
-	m mmap.MMap
+	f    io.Closer
+	m    mmap.MMap
+	mode MapMode
 }
 
+// MapMode is the way the file is memory mapped.
+type MapMode int
+
+const (
+	// ReadOnly maps the file read-only. Modifying Tensor.Data crashes.
+	ReadOnly MapMode = iota
+	// ReadWrite maps the file shared and writable. Modifications to
+	// Tensor.Data are written back to the file.
+	ReadWrite
+	// CopyOnWrite maps the file privately. Modifications to Tensor.Data are
+	// only visible to this process and are never written to the file.
+	CopyOnWrite
+)
+
 // Close releases the memory region and the file handle.
+//
+// In ReadWrite mode, the modifications are flushed first.
 func (s *Mapped) Close() error {
-	err := s.m.Unmap()
+	var err error
+	if s.mode == ReadWrite {
+		err = s.m.Flush()
+	}
+	if err2 := s.m.Unmap(); err == nil {
+		err = err2
+	}
 	if err2 := s.f.Close(); err == nil {
 		err = err2
 	}
 	return err
 }
 
+// Flush synchronously writes the modifications to the file in ReadWrite mode.
+// It is a no-op in other modes.
+func (s *Mapped) Flush() error {
+	if s.m == nil {
+		return errors.New("not opened")
+	}
+	if s.mode != ReadWrite {
+		return nil
+	}
+	return s.m.Flush()
+}
+
 // Open opens a file and memory maps it read-only.
 func (s *Mapped) Open(name string) error {
-	f, err := os.OpenFile(name, os.O_RDONLY, 0o600)
+	return s.OpenMode(name, ReadOnly)
+}
+
+// OpenMode opens a file and memory maps it with the specified mode.
+//
+// Only the tensors' data may be modified, the header must be left untouched.
+func (s *Mapped) OpenMode(name string, mode MapMode) error {
+	return s.open(name, mode, nil)
+}
+
+// OpenWithOptions is OpenMode with parsing options, e.g. limits to memory map
+// untrusted files.
+//
+// Unlike OpenContext, the pages are not faulted in.
+func (s *Mapped) OpenWithOptions(name string, mode MapMode, opts *ParseOptions) error {
+	return s.open(name, mode, opts)
+}
+
+func (s *Mapped) open(name string, mode MapMode, opts *ParseOptions) error {
+	flag, prot := os.O_RDONLY, mmap.RDONLY
+	switch mode {
+	case ReadOnly:
+	case ReadWrite:
+		flag, prot = os.O_RDWR, mmap.RDWR
+	case CopyOnWrite:
+		prot = mmap.COPY
+	default:
+		return fmt.Errorf("invalid mode %d", mode)
+	}
+	f, err := os.OpenFile(name, flag, 0o600)
 	if err != nil {
 		return err
 	}
-	m, err := mmap.Map(f, mmap.RDONLY, 0)
+	m, err := mmap.Map(f, prot, 0)
 	if err != nil {
 		_ = f.Close()
 		return err
 	}
 	s.f = f
 	s.m = m
-	s.File, err = Parse(m)
+	s.mode = mode
+	s.File, err = ParseWithOptions(m, opts)
 	if err != nil {
 		_ = s.Close()
 		return err
 	}
 	return nil
 }
+
+// OpenContext opens a file, memory maps it with opts.Mode and faults in every
+// page of the tensors' data so the file is resident in memory when it returns.
+//
+// The context is checked between tensors and between chunks of large tensors.
+// Progress is reported in bytes loaded.
+func (s *Mapped) OpenContext(ctx context.Context, name string, opts *LoadOptions) error {
+	if opts == nil {
+		opts = &LoadOptions{}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := s.open(name, opts.Mode, &opts.ParseOptions); err != nil {
+		return err
+	}
+	hdr := uint64(len(s.m))
+	for i := range s.Tensors {
+		hdr -= uint64(len(s.Tensors[i].Data))
+	}
+	p := progress{fn: opts.Progress, done: hdr, total: uint64(len(s.m))}
+	p.report()
+	pageSize := os.Getpagesize()
+	for _, t := range s.Tensors {
+		for d := t.Data; len(d) != 0; {
+			if err := ctx.Err(); err != nil {
+				_ = s.Close()
+				return err
+			}
+			c := d[:min(len(d), progressChunk)]
+			touchPages(c, pageSize)
+			d = d[len(c):]
+			p.add(len(c))
+		}
+	}
+	return nil
+}
+
+// touchPages reads one byte per page to fault them in.
+//
+//go:noinline
+func touchPages(b []byte, pageSize int) byte {
+	var x byte
+	for i := 0; i < len(b); i += pageSize {
+		x ^= b[i]
+	}
+	return x
+}
+
+// Advice is an access pattern hint for the memory mapped region.
+type Advice int
+
+const (
+	// AdviceNormal is the default access pattern.
+	AdviceNormal Advice = iota
+	// AdviceSequential hints that pages will be accessed in order, enabling
+	// aggressive read ahead.
+	AdviceSequential
+	// AdviceRandom hints that pages will be accessed randomly, disabling read
+	// ahead.
+	AdviceRandom
+)
+
+// Advise sets the access pattern hint for the whole mapping.
+//
+// It is a no-op on platforms without madvise.
+func (s *Mapped) Advise(a Advice) error {
+	if a < AdviceNormal || a > AdviceRandom {
+		return fmt.Errorf("invalid advice %d", a)
+	}
+	return madvise(s.m, a)
+}
+
+// Prefetch hints the kernel to start reading the named tensors into memory
+// (MADV_WILLNEED). It returns immediately. When no name is specified, all the
+// tensors are prefetched.
+//
+// It is a no-op on platforms without madvise.
+func (s *Mapped) Prefetch(names ...string) error {
+	return s.forRanges(names, willNeed)
+}
+
+// Evict hints the kernel that the named tensors' pages are not needed anymore
+// (MADV_DONTNEED). They will be read back from the file on next access. When no
+// name is specified, all the tensors are evicted.
+//
+// In CopyOnWrite mode, this discards the private modifications.
+//
+// It is a no-op on platforms without madvise.
+func (s *Mapped) Evict(names ...string) error {
+	return s.forRanges(names, dontNeed)
+}
+
+// Lock locks the named tensors' pages in memory (mlock) so they are never
+// paged out. When no name is specified, all the tensors are locked.
+//
+// Locking is subject to RLIMIT_MEMLOCK.
+func (s *Mapped) Lock(names ...string) error {
+	return s.forRanges(names, mlock)
+}
+
+// Unlock reverts Lock.
+func (s *Mapped) Unlock(names ...string) error {
+	return s.forRanges(names, munlock)
+}
+
+// forRanges calls fn on the page aligned region of each named tensor.
+func (s *Mapped) forRanges(names []string, fn func(b []byte) error) error {
+	if s.m == nil {
+		return errors.New("not opened")
+	}
+	var tensors []*Tensor
+	if len(names) == 0 {
+		for i := range s.Tensors {
+			tensors = append(tensors, &s.Tensors[i])
+		}
+	} else {
+		for _, name := range names {
+			i := slices.IndexFunc(s.Tensors, func(t Tensor) bool { return t.Name == name })
+			if i == -1 {
+				return fmt.Errorf("tensor %q not found", name)
+			}
+			tensors = append(tensors, &s.Tensors[i])
+		}
+	}
+	pageSize := os.Getpagesize()
+	base := uintptr(unsafe.Pointer(unsafe.SliceData(s.m)))
+	for _, t := range tensors {
+		if len(t.Data) == 0 {
+			continue
+		}
+		start := int(uintptr(unsafe.Pointer(unsafe.SliceData(t.Data))) - base)
+		end := start + len(t.Data)
+		start -= start % pageSize
+		if err := fn(s.m[start:end]); err != nil {
+			return fmt.Errorf("tensor %q: %w", t.Name, err)
+		}
+	}
+	return nil
+}
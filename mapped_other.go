@@ -0,0 +1,29 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+//go:build !(darwin || dragonfly || freebsd || linux || openbsd || solaris || netbsd)
+
+package safetensors
+
+import "errors"
+
+func madvise(b []byte, a Advice) error {
+	return nil
+}
+
+func willNeed(b []byte) error {
+	return nil
+}
+
+func dontNeed(b []byte) error {
+	return nil
+}
+
+func mlock(b []byte) error {
+	return errors.ErrUnsupported
+}
+
+func munlock(b []byte) error {
+	return errors.ErrUnsupported
+}
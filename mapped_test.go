@@ -5,6 +5,9 @@
 package safetensors
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
@@ -34,3 +37,141 @@ func TestMapped_Error(t *testing.T) {
 		t.Fatal("expected error")
 	}
 }
+
+func TestMapped_OpenContext(t *testing.T) {
+	n := filepath.Join(t.TempDir(), "model.safetensors")
+	buf := bytes.Buffer{}
+	if err := makeTestFile(3).Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(n, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var last [2]uint64
+	m := Mapped{}
+	opts := LoadOptions{Progress: func(done, total uint64) { last = [2]uint64{done, total} }}
+	if err := m.OpenContext(context.Background(), n, &opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if l := uint64(buf.Len()); last != [2]uint64{l, l} {
+		t.Fatal(last)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := m.OpenContext(ctx, n, nil); !errors.Is(err, context.Canceled) {
+		t.Fatal(err)
+	}
+}
+
+func TestMapped_OpenWithOptions(t *testing.T) {
+	n := filepath.Join(t.TempDir(), "model.safetensors")
+	buf := bytes.Buffer{}
+	if err := makeTestFile(3).Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(n, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	m := Mapped{}
+	if err := m.OpenWithOptions(n, ReadOnly, &ParseOptions{MaxTensors: 2}); !errors.Is(err, ErrLimitExceeded) {
+		t.Fatal(err)
+	}
+	if err := m.OpenWithOptions(n, CopyOnWrite, &ParseOptions{MaxTensors: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Tensors) != 3 {
+		t.Fatal(m.Tensors)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMapped_Advise(t *testing.T) {
+	n := filepath.Join(t.TempDir(), "model.safetensors")
+	buf := bytes.Buffer{}
+	if err := makeTestFile(3).Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(n, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	m := Mapped{}
+	if err := m.Prefetch(); err == nil {
+		t.Fatal("expected error")
+	}
+	if err := m.Open(n); err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	if err := m.Advise(AdviceRandom); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Advise(Advice(42)); err == nil {
+		t.Fatal("expected error")
+	}
+	if err := m.Prefetch("t1", "t2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Evict(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Evict("missing"); err == nil || err.Error() != "tensor \"missing\" not found" {
+		t.Fatal(err)
+	}
+	if err := m.Lock("t0"); err != nil {
+		t.Skip(err)
+	}
+	if err := m.Unlock("t0"); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.Tensors[2].Data; F32.decode(got[4:]) != -2 {
+		t.Fatal(got)
+	}
+}
+
+func TestMapped_OpenMode(t *testing.T) {
+	n := filepath.Join(t.TempDir(), "model.safetensors")
+	buf := bytes.Buffer{}
+	if err := makeTestFile(3).Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(n, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, mode := range []MapMode{CopyOnWrite, ReadWrite} {
+		m := Mapped{}
+		if err := m.OpenMode(n, mode); err != nil {
+			t.Fatal(err)
+		}
+		F32.encode(m.Tensors[1].Data, 42)
+		if err := m.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.Close(); err != nil {
+			t.Fatal(err)
+		}
+		d, err := os.ReadFile(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := Parse(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := 1.
+		if mode == ReadWrite {
+			want = 42
+		}
+		if got := F32.decode(f.Tensors[1].Data); got != want {
+			t.Fatalf("mode %d: want %g, got %g", mode, want, got)
+		}
+	}
+	m := Mapped{}
+	if err := m.OpenMode(n, MapMode(42)); err == nil || err.Error() != "invalid mode 42" {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,36 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed under the Apache License, Version 2.0
+// that can be found in the LICENSE file.
+
+//go:build darwin || dragonfly || freebsd || linux || openbsd || solaris || netbsd
+
+package safetensors
+
+import "golang.org/x/sys/unix"
+
+func madvise(b []byte, a Advice) error {
+	switch a {
+	case AdviceSequential:
+		return unix.Madvise(b, unix.MADV_SEQUENTIAL)
+	case AdviceRandom:
+		return unix.Madvise(b, unix.MADV_RANDOM)
+	default:
+		return unix.Madvise(b, unix.MADV_NORMAL)
+	}
+}
+
+func willNeed(b []byte) error {
+	return unix.Madvise(b, unix.MADV_WILLNEED)
+}
+
+func dontNeed(b []byte) error {
+	return unix.Madvise(b, unix.MADV_DONTNEED)
+}
+
+func mlock(b []byte) error {
+	return unix.Mlock(b)
+}
+
+func munlock(b []byte) error {
+	return unix.Munlock(b)
+}
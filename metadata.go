@@ -0,0 +1,86 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package safetensors
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"os"
+)
+
+// EditMetadata modifies the __metadata__ of a safetensors file without
+// touching the tensors' data.
+//
+// fn is called with a copy of the current string metadata, which may be
+// modified in place. The map is never nil. Non-string metadata values and
+// unknown tensor fields are preserved.
+//
+// When the new header fits in the space of the current one, only the header is
+// overwritten and the rest is padded with spaces. Otherwise the file is
+// atomically rewritten via WriteFile's temporary file and rename, reserving
+// editPadding so the following edits can usually be done in place.
+func EditMetadata(name string, fn func(m map[string]string)) error {
+	f, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	h := safeTensorsHeader{}
+	n, err := h.parseHeaderReader(f, &ParseOptions{Lossless: true})
+	if err != nil {
+		return fmt.Errorf("invalid header: %w", err)
+	}
+	bufferEnd, err := h.validate()
+	if err != nil {
+		return fmt.Errorf("invalid metadata: %w", err)
+	}
+	if err := checkSize(bufferEnd+8+n, uint64(fi.Size())); err != nil {
+		return err
+	}
+	m := maps.Clone(h.metadata)
+	if m == nil {
+		m = map[string]string{}
+	}
+	fn(m)
+	h.metadata = m
+	b, err := h.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	if uint64(len(b)) <= n {
+		for uint64(len(b)) < n {
+			b = append(b, ' ')
+		}
+		if _, err = f.WriteAt(b, 8); err != nil {
+			return err
+		}
+		return f.Sync()
+	}
+	b, err = h.encode(editPadding(len(b)))
+	if err != nil {
+		return err
+	}
+	return writeAtomic(name, &WriteFileOptions{Perm: fi.Mode().Perm()}, func(w *os.File) error {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+		if _, err := io.Copy(w, io.NewSectionReader(f, int64(8+n), int64(bufferEnd))); err != nil {
+			return err
+		}
+		// Close before the rename, which fails on Windows otherwise.
+		return f.Close()
+	})
+}
+
+// editPadding returns the space reserved in a header of size n rewritten by
+// EditMetadata: a quarter of its size, at least 1KiB.
+func editPadding(n int) int {
+	return max(n/4, 1024)
+}
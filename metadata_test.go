@@ -0,0 +1,101 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package safetensors
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestEditMetadata(t *testing.T) {
+	n := filepath.Join(t.TempDir(), "model.safetensors")
+	orig := makeTestFile(3)
+	orig.Metadata = map[string]string{"license": "mit", "step": "100000"}
+	if err := WriteFile(n, orig, nil); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Shrinks; rewritten in place.
+	if err := EditMetadata(n, func(m map[string]string) { delete(m, "step") }); err != nil {
+		t.Fatal(err)
+	}
+	check := func(want map[string]string) int64 {
+		d, err := os.ReadFile(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := Parse(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(want, f.Metadata); diff != "" {
+			t.Fatalf("(-want,+got)\n%s", diff)
+		}
+		if diff := cmp.Diff(orig.Tensors, f.Tensors); diff != "" {
+			t.Fatalf("(-want,+got)\n%s", diff)
+		}
+		return int64(len(d))
+	}
+	if size := check(map[string]string{"license": "mit"}); size != fi.Size() {
+		t.Fatalf("%d != %d", size, fi.Size())
+	}
+	// Grows; the file is rewritten.
+	long := strings.Repeat("x", 100)
+	if err := EditMetadata(n, func(m map[string]string) { m["provenance"] = long }); err != nil {
+		t.Fatal(err)
+	}
+	size := check(map[string]string{"license": "mit", "provenance": long})
+	if size <= fi.Size() {
+		t.Fatalf("%d <= %d", size, fi.Size())
+	}
+	// Grows again; fits in the padding reserved by the rewrite.
+	if err := EditMetadata(n, func(m map[string]string) { m["other"] = long }); err != nil {
+		t.Fatal(err)
+	}
+	if size2 := check(map[string]string{"license": "mit", "provenance": long, "other": long}); size2 != size {
+		t.Fatalf("file was rewritten: %d != %d", size2, size)
+	}
+}
+
+func TestEditMetadata_HeaderPadding(t *testing.T) {
+	n := filepath.Join(t.TempDir(), "model.safetensors")
+	if err := WriteFile(n, makeTestFile(3), &WriteFileOptions{SerializeOptions: SerializeOptions{HeaderPadding: 256}}); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := EditMetadata(n, func(m map[string]string) { m["provenance"] = strings.Repeat("x", 200) }); err != nil {
+		t.Fatal(err)
+	}
+	fi2, err := os.Stat(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() != fi2.Size() {
+		t.Fatalf("file was rewritten: %d != %d", fi.Size(), fi2.Size())
+	}
+}
+
+func TestEditMetadata_Error(t *testing.T) {
+	n := filepath.Join(t.TempDir(), "model.safetensors")
+	if err := EditMetadata(n, func(m map[string]string) {}); err == nil {
+		t.Fatal("expected error")
+	}
+	if err := os.WriteFile(n, []byte("\x02\x00\x00\x00\x00\x00\x00\x00{}"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := EditMetadata(n, func(m map[string]string) {}); err == nil || err.Error() != "invalid header: empty tensors" {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package safetensors
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Order is the policy used to lay out the tensors' data in a file.
+//
+// It never affects the order of the tensors in the JSON header, which is
+// always the order of File.Tensors.
+type Order int
+
+const (
+	// OrderHeader lays out the data in the same order as File.Tensors.
+	OrderHeader Order = iota
+	// OrderAlphabetical lays out the data sorted by tensor name, like the
+	// reference implementation.
+	OrderAlphabetical
+	// OrderSize lays out the largest tensors first. Ties keep the header
+	// order.
+	OrderSize
+	// OrderLayer lays out the data sorted by name where runs of digits are
+	// compared numerically, so "model.layers.2.mlp" comes before
+	// "model.layers.10.attn" and the tensors of each layer are contiguous.
+	OrderLayer
+)
+
+// sortIndexes returns the index of each tensor in the order their data is
+// written.
+func (o Order) sortIndexes(tensors []Tensor) ([]int, error) {
+	order := make([]int, len(tensors))
+	for i := range order {
+		order[i] = i
+	}
+	switch o {
+	case OrderHeader:
+	case OrderAlphabetical:
+		slices.SortStableFunc(order, func(a, b int) int {
+			return strings.Compare(tensors[a].Name, tensors[b].Name)
+		})
+	case OrderSize:
+		slices.SortStableFunc(order, func(a, b int) int {
+			return cmp.Compare(len(tensors[b].Data), len(tensors[a].Data))
+		})
+	case OrderLayer:
+		slices.SortStableFunc(order, func(a, b int) int {
+			return compareNatural(tensors[a].Name, tensors[b].Name)
+		})
+	default:
+		return nil, fmt.Errorf("invalid order %d", o)
+	}
+	return order, nil
+}
+
+// compareNatural compares a and b where runs of ASCII digits are compared by
+// numerical value.
+func compareNatural(a, b string) int {
+	for a != "" && b != "" {
+		if isDigit(a[0]) && isDigit(b[0]) {
+			na, ra := splitDigits(a)
+			nb, rb := splitDigits(b)
+			// Compare the values without parsing to not overflow.
+			ta := strings.TrimLeft(na, "0")
+			tb := strings.TrimLeft(nb, "0")
+			if c := cmp.Compare(len(ta), len(tb)); c != 0 {
+				return c
+			}
+			if c := strings.Compare(ta, tb); c != 0 {
+				return c
+			}
+			if c := cmp.Compare(len(na), len(nb)); c != 0 {
+				return c
+			}
+			a, b = ra, rb
+			continue
+		}
+		if c := cmp.Compare(a[0], b[0]); c != 0 {
+			return c
+		}
+		a, b = a[1:], b[1:]
+	}
+	return cmp.Compare(len(a), len(b))
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func splitDigits(s string) (string, string) {
+	i := 0
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	return s[:i], s[i:]
+}
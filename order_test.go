@@ -0,0 +1,79 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package safetensors
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSerialize_Order(t *testing.T) {
+	f := &File{
+		Tensors: []Tensor{
+			{Name: "model.layers.10.w", DType: U8, Shape: []uint64{1}, Data: []byte{1}},
+			{Name: "model.layers.2.w", DType: U8, Shape: []uint64{3}, Data: []byte{2, 2, 2}},
+			{Name: "empty", DType: U8, Shape: []uint64{0}, Data: []byte{}},
+			{Name: "lm_head", DType: U8, Shape: []uint64{2}, Data: []byte{3, 3}},
+		},
+	}
+	data := []struct {
+		order Order
+		want  []string
+	}{
+		{OrderHeader, []string{"model.layers.10.w", "model.layers.2.w", "empty", "lm_head"}},
+		{OrderAlphabetical, []string{"empty", "lm_head", "model.layers.10.w", "model.layers.2.w"}},
+		{OrderSize, []string{"model.layers.2.w", "lm_head", "model.layers.10.w", "empty"}},
+		{OrderLayer, []string{"empty", "lm_head", "model.layers.2.w", "model.layers.10.w"}},
+	}
+	for _, line := range data {
+		out := bytes.Buffer{}
+		if err := f.SerializeContext(context.Background(), &out, &SerializeOptions{Order: line.order}); err != nil {
+			t.Fatal(err)
+		}
+		g, err := Parse(out.Bytes())
+		if err != nil {
+			t.Fatalf("%d: %v", line.order, err)
+		}
+		// The header order is preserved.
+		if diff := cmp.Diff(f.Tensors, g.Tensors); diff != "" {
+			t.Fatalf("%d: (-want,+got)\n%s", line.order, diff)
+		}
+		// The data is laid out according to the policy.
+		h := safeTensorsHeader{}
+		if _, err := h.parseHeaderBytes(out.Bytes(), nil); err != nil {
+			t.Fatal(err)
+		}
+		slices.SortStableFunc(h.tensors, func(a, b tensorInfo) int {
+			return int(a.DataOffsets[1]) - int(b.DataOffsets[1])
+		})
+		var names []string
+		for _, t := range h.tensors {
+			names = append(names, t.name)
+		}
+		if diff := cmp.Diff(line.want, names); diff != "" {
+			t.Fatalf("%d: (-want,+got)\n%s", line.order, diff)
+		}
+	}
+	if err := f.SerializeContext(context.Background(), &bytes.Buffer{}, &SerializeOptions{Order: 42}); err == nil {
+		t.Fatal("expected error")
+	}
+	if err := f.SerializeContext(context.Background(), &bytes.Buffer{}, &SerializeOptions{Order: OrderSize, Canonical: true}); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestCompareNatural(t *testing.T) {
+	want := []string{"", "a", "a0", "a00", "a1", "a2", "a2b", "a10", "a010b", "b"}
+	got := slices.Clone(want)
+	slices.Reverse(got)
+	slices.SortFunc(got, compareNatural)
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("(-want,+got)\n%s", diff)
+	}
+}
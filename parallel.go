@@ -0,0 +1,112 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package safetensors
+
+import (
+	"context"
+	"hash"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// ParallelOptions controls the concurrency of bulk operations on a File.
+type ParallelOptions struct {
+	// Parallelism is the maximum number of tensors processed concurrently.
+	// Defaults to runtime.GOMAXPROCS(0) when zero or negative.
+	Parallelism int
+}
+
+func (o *ParallelOptions) workers(n int) int {
+	w := 0
+	if o != nil {
+		w = o.Parallelism
+	}
+	if w <= 0 {
+		w = runtime.GOMAXPROCS(0)
+	}
+	return min(w, n)
+}
+
+// ForEach calls fn for each tensor using a pool of workers.
+//
+// fn is called concurrently and must not modify f.Tensors itself. Tensors are
+// dispatched in order. Once ctx is cancelled or fn returns an error, no new
+// tensor is dispatched. The error of the tensor with the lowest index is
+// returned, which makes the result deterministic.
+func (f *File) ForEach(ctx context.Context, opts *ParallelOptions, fn func(i int, t *Tensor) error) error {
+	n := len(f.Tensors)
+	errs := make([]error, n)
+	var next atomic.Int64
+	var stop atomic.Bool
+	var wg sync.WaitGroup
+	for range opts.workers(n) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for !stop.Load() && ctx.Err() == nil {
+				i := int(next.Add(1) - 1)
+				if i >= n {
+					return
+				}
+				if errs[i] = fn(i, &f.Tensors[i]); errs[i] != nil {
+					stop.Store(true)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return &TensorError{Name: f.Tensors[i].Name, Index: i, Err: err}
+		}
+	}
+	return ctx.Err()
+}
+
+// ValidateTensors validates all the tensors concurrently.
+func (f *File) ValidateTensors(ctx context.Context, opts *ParallelOptions) error {
+	return f.ForEach(ctx, opts, func(i int, t *Tensor) error {
+		return t.Validate()
+	})
+}
+
+// Hash returns the digest of each tensor's data, in tensor order.
+//
+// newHash is called once per tensor, e.g. sha256.New.
+func (f *File) Hash(ctx context.Context, opts *ParallelOptions, newHash func() hash.Hash) ([][]byte, error) {
+	out := make([][]byte, len(f.Tensors))
+	err := f.ForEach(ctx, opts, func(i int, t *Tensor) error {
+		h := newHash()
+		_, _ = h.Write(t.Data)
+		out[i] = h.Sum(nil)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CastFloats returns a new File where all the floating point tensors are
+// converted to dtype. Other tensors are shared with f.
+//
+// See Tensor.Cast for the conversion rules.
+func (f *File) CastFloats(ctx context.Context, opts *ParallelOptions, dtype DType) (*File, error) {
+	out := &File{Tensors: make([]Tensor, len(f.Tensors)), Metadata: f.Metadata}
+	err := f.ForEach(ctx, opts, func(i int, t *Tensor) error {
+		if !t.DType.IsFloat() {
+			out.Tensors[i] = *t
+			return nil
+		}
+		var err error
+		out.Tensors[i], err = t.Cast(dtype)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,95 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package safetensors
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func makeTestFile(n int) *File {
+	f := &File{}
+	for i := range n {
+		d := make([]byte, 8)
+		F32.encode(d, float64(i))
+		F32.encode(d[4:], float64(-i))
+		f.Tensors = append(f.Tensors, Tensor{Name: "t" + strconv.Itoa(i), DType: F32, Shape: []uint64{2}, Data: d})
+	}
+	return f
+}
+
+func TestFile_ForEach_Error(t *testing.T) {
+	f := makeTestFile(100)
+	for range 10 {
+		err := f.ForEach(context.Background(), &ParallelOptions{Parallelism: 8}, func(i int, t *Tensor) error {
+			if i == 13 || i == 60 {
+				return errors.New("fail")
+			}
+			return nil
+		})
+		if err == nil || err.Error() != "tensor \"t13\" #13: fail" {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFile_ForEach_Cancel(t *testing.T) {
+	f := makeTestFile(100)
+	ctx, cancel := context.WithCancel(context.Background())
+	seen := 0
+	err := f.ForEach(ctx, &ParallelOptions{Parallelism: 1}, func(i int, t *Tensor) error {
+		if seen++; seen == 5 {
+			cancel()
+		}
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatal(err)
+	}
+	if seen != 5 {
+		t.Fatal(seen)
+	}
+}
+
+func TestFile_Hash(t *testing.T) {
+	f := makeTestFile(20)
+	if err := f.ValidateTensors(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	got, err := f.Hash(context.Background(), &ParallelOptions{Parallelism: 4}, sha256.New)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range f.Tensors {
+		want := sha256.Sum256(f.Tensors[i].Data)
+		if string(want[:]) != string(got[i]) {
+			t.Fatalf("#%d mismatch", i)
+		}
+	}
+}
+
+func TestFile_CastFloats(t *testing.T) {
+	f := makeTestFile(20)
+	f.Tensors = append(f.Tensors, Tensor{Name: "ids", DType: I32, Shape: []uint64{1}, Data: make([]byte, 4)})
+	got, err := f.CastFloats(context.Background(), nil, BF16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range got.Tensors {
+		want := BF16
+		if i == 20 {
+			want = I32
+		}
+		if got.Tensors[i].DType != want || got.Tensors[i].Name != f.Tensors[i].Name {
+			t.Fatalf("#%d: %+v", i, got.Tensors[i])
+		}
+	}
+	if v := BF16.decode(got.Tensors[7].Data[2:]); v != -7 {
+		t.Fatal(v)
+	}
+}
@@ -7,11 +7,14 @@ package safetensors
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"math"
+	"slices"
 	"sort"
 )
 
@@ -24,13 +27,23 @@ type Tensor struct {
 	DType DType
 	Shape []uint64
 	Data  []byte
+	// Extra contains the unknown fields of the tensor's header entry. It is
+	// only set when parsing with ParseOptions.Lossless and is written back
+	// as is.
+	Extra []RawField
 }
 
 // Validate validates the object.
 func (t *Tensor) Validate() error {
-	numElements := numElementsFromShape(t.Shape)
-	if n := uint64(len(t.Data)); n != numElements*t.DType.WordSize() {
-		return fmt.Errorf("invalid tensor: dtype=%s shape=%+v len(data)=%d", t.DType, t.Shape, n)
+	if t.DType.WordSize() == 0 {
+		return errorf(ErrInvalidDType, "%q is not a valid DType", t.DType)
+	}
+	numBytes, err := byteSize(t.DType, t.Shape)
+	if err != nil {
+		return err
+	}
+	if n := uint64(len(t.Data)); n != numBytes {
+		return errorf(ErrShapeMismatch, "invalid tensor: dtype=%s shape=%+v len(data)=%d", t.DType, t.Shape, n)
 	}
 	return nil
 }
@@ -40,6 +53,15 @@ func (t *Tensor) Validate() error {
 type File struct {
 	Tensors  []Tensor
 	Metadata map[string]string
+	// RawMetadata contains all the __metadata__ entries verbatim in header
+	// order, including non-string values. It is only set when parsing with
+	// ParseOptions.Lossless.
+	//
+	// When not nil, it is written back by Serialize with the string entries of
+	// Metadata applied over it: unchanged entries keep their exact encoding,
+	// entries removed from Metadata are dropped, and new entries are appended
+	// sorted by key.
+	RawMetadata []RawField
 }
 
 // Parse parses a byte-buffer representing the whole safetensors file and
@@ -47,8 +69,13 @@ type File struct {
 //
 // It keeps references to the buffer so the buffer must not be modified afterwards.
 func Parse(buffer []byte) (*File, error) {
+	return ParseWithOptions(buffer, nil)
+}
+
+// ParseWithOptions is Parse with options.
+func ParseWithOptions(buffer []byte, opts *ParseOptions) (*File, error) {
 	h := safeTensorsHeader{}
-	n, err := h.parseHeaderBytes(buffer)
+	n, err := h.parseHeaderBytes(buffer, opts)
 	if err != nil {
 		return nil, fmt.Errorf("invalid header: %w", err)
 	}
@@ -56,10 +83,13 @@ func Parse(buffer []byte) (*File, error) {
 	if err != nil {
 		return nil, fmt.Errorf("invalid metadata: %w", err)
 	}
-	if bufferEnd+8+n != uint64(len(buffer)) {
-		return nil, fmt.Errorf("metadata incomplete buffer: %d != %d", bufferEnd+8+n, uint64(len(buffer)))
+	if err := opts.checkDataSize(bufferEnd); err != nil {
+		return nil, err
+	}
+	if err := checkSize(bufferEnd+8+n, uint64(len(buffer))); err != nil {
+		return nil, err
 	}
-	f := &File{Metadata: h.metadata, Tensors: make([]Tensor, len(h.tensors))}
+	f := &File{Metadata: h.metadata, RawMetadata: h.rawMetadata, Tensors: make([]Tensor, len(h.tensors))}
 	data := buffer[n+8:]
 	for i := range h.tensors {
 		h.tensors[i].toTensor(&f.Tensors[i], data[h.tensors[i].DataOffsets[0]:h.tensors[i].DataOffsets[1]])
@@ -76,7 +106,7 @@ func Parse(buffer []byte) (*File, error) {
 // Unexported because it's slow as fuck.
 func deserialize(r io.Reader) (*File, error) {
 	h := safeTensorsHeader{}
-	n, err := h.parseHeaderReader(r)
+	n, err := h.parseHeaderReader(r, nil)
 	if err != nil {
 		return nil, fmt.Errorf("invalid header: %w", err)
 	}
@@ -84,7 +114,7 @@ func deserialize(r io.Reader) (*File, error) {
 	if err != nil {
 		return nil, fmt.Errorf("invalid metadata: %w", err)
 	}
-	f := &File{Metadata: h.metadata, Tensors: make([]Tensor, len(h.tensors))}
+	f := &File{Metadata: h.metadata, RawMetadata: h.rawMetadata, Tensors: make([]Tensor, len(h.tensors))}
 	total := n
 	for i := range h.tensors {
 		buf := bytes.Buffer{}
@@ -92,7 +122,7 @@ func deserialize(r io.Reader) (*File, error) {
 		x := h.tensors[i].DataOffsets[1] - h.tensors[i].DataOffsets[0]
 		buf.Grow(int(x))
 		if _, err := io.CopyN(&buf, r, int64(x)); err != nil {
-			return nil, fmt.Errorf("tensor %q #%d: read error: %w", h.tensors[i].name, i, err)
+			return nil, &TensorError{Name: h.tensors[i].name, Index: i, Offsets: h.tensors[i].DataOffsets, Err: errorf(ErrTruncated, "read error: %w", err)}
 		}
 		total += x
 		h.tensors[i].toTensor(&f.Tensors[i], buf.Bytes())
@@ -101,52 +131,276 @@ func deserialize(r io.Reader) (*File, error) {
 		}
 	}
 	if bufferEnd+n != total {
-		return nil, fmt.Errorf("metadata incomplete buffer: %d != %d", bufferEnd+8+n, total)
+		return nil, errorf(ErrTruncated, "metadata incomplete buffer: %d != %d", bufferEnd+8+n, total)
 	}
 	return f, nil
 }
 
+// ProgressFunc is called to report progress as bytes processed over the total
+// number of bytes.
+type ProgressFunc func(done, total uint64)
+
+// SerializeOptions controls how a File is serialized.
+type SerializeOptions struct {
+	// Progress, if set, is called after each chunk of data is written.
+	Progress ProgressFunc
+	// HeaderPadding is the number of extra spaces reserved at the end of the
+	// JSON header. It permits later edits of the header in place, e.g. with
+	// EditMetadata, without rewriting the tensors' data.
+	HeaderPadding int
+	// Canonical writes a byte-stable representation that only depends on the
+	// tensors' names, dtypes, shapes and data and on Metadata:
+	//   - the header is a JSON object without insignificant whitespace;
+	//   - "__metadata__" comes first when Metadata is not empty, with its keys
+	//     sorted by byte value;
+	//   - tensors follow sorted by name by byte value, each as
+	//     {"dtype":...,"shape":[...],"data_offsets":[start,end]};
+	//   - the tensors' data is laid out in the same order, without gaps;
+	//   - strings are valid UTF-8 where only '"', '\' and control characters
+	//     are escaped, using the short forms \b \f \n \r \t when available and
+	//     lowercase \u00xx otherwise;
+	//   - the header is padded with spaces to a multiple of 8 bytes.
+	//
+	// RawMetadata, Tensor.Extra, HeaderPadding, Order and duplicate tensor
+	// names are rejected. See IsCanonical to check a file.
+	Canonical bool
+	// Order is the layout of the tensors' data. The JSON header always lists
+	// the tensors in the order of File.Tensors.
+	Order Order
+	// Dedup stores identical tensors only once. See File.Dedup.
+	Dedup bool
+}
+
+// LoadOptions controls how a File is loaded.
+type LoadOptions struct {
+	// Progress, if set, is called after each chunk of data is read.
+	Progress ProgressFunc
+	// Mode is the memory mapping mode. It is only used by Mapped.OpenContext.
+	Mode MapMode
+	ParseOptions
+}
+
+// ParseOptions controls how a safetensors file is parsed.
+type ParseOptions struct {
+	// Strict rejects files that the reference Rust implementation
+	// (https://github.com/huggingface/safetensors) rejects but that are
+	// otherwise accepted:
+	//   - the header is not valid UTF-8;
+	//   - the header doesn't start with '{', e.g. leading whitespace;
+	//   - a key is duplicated at any depth, including duplicate tensor names,
+	//     duplicate "__metadata__" or duplicate fields in a tensor entry;
+	//   - a tensor entry misses "dtype", "shape" or "data_offsets", spelled
+	//     with this exact case.
+	//
+	// Gaps or overlaps between tensors' data are rejected in both modes.
+	// Non-string metadata values are rejected in strict mode even with
+	// Lossless.
+	Strict bool
+	// Lossless keeps the unknown tensor entry fields in Tensor.Extra and the
+	// whole __metadata__, including non-string values, in File.RawMetadata.
+	// Non-string metadata values are otherwise rejected, and still are with
+	// Strict.
+	//
+	// Serializing a File parsed this way reproduces a compact header, like
+	// the one written by this package or the reference implementation, byte
+	// for byte as long as the data is laid out in header order.
+	Lossless bool
+
+	// Limits to bound the resources used when parsing untrusted files. Zero
+	// means no limit, except for MaxHeaderSize. Exceeding a limit returns an
+	// error matching ErrLimitExceeded, or ErrHeaderTooLarge for
+	// MaxHeaderSize.
+
+	// MaxHeaderSize is the maximum size of the JSON header in bytes. Defaults
+	// to 100MB.
+	MaxHeaderSize uint64
+	// MaxTensors is the maximum number of tensors.
+	MaxTensors int
+	// MaxRank is the maximum number of dimensions of a tensor.
+	MaxRank int
+	// MaxMetadataEntries is the maximum number of entries in __metadata__.
+	MaxMetadataEntries int
+	// MaxMetadataValueLen is the maximum length in bytes of a key or a value in
+	// __metadata__.
+	MaxMetadataValueLen int
+	// MaxDataSize is the maximum total size of the tensors' data in bytes.
+	MaxDataSize uint64
+}
+
 // Serialize the list of tensors to an io.Writer.
 func (f *File) Serialize(w io.Writer) error {
-	r := safeTensorsHeader{metadata: f.Metadata, tensors: make([]tensorInfo, len(f.Tensors))}
-	var offset uint64
-	for i := range r.tensors {
-		if err := f.Tensors[i].Validate(); err != nil {
+	return f.SerializeContext(context.Background(), w, nil)
+}
+
+// SerializeContext serializes the list of tensors to an io.Writer.
+//
+// The context is checked between tensors and between chunks of large tensors.
+func (f *File) SerializeContext(ctx context.Context, w io.Writer, opts *SerializeOptions) error {
+	if opts == nil {
+		opts = &SerializeOptions{}
+	}
+	if opts.HeaderPadding < 0 {
+		return fmt.Errorf("invalid header padding %d", opts.HeaderPadding)
+	}
+	if opts.Dedup {
+		var err error
+		if f, err = f.Dedup(); err != nil {
 			return err
 		}
-		offset = r.tensors[i].fromTensor(&f.Tensors[i], offset)
 	}
-	b, err := r.MarshalJSON()
+	b, order, err := f.encodeHeader(opts)
 	if err != nil {
 		return err
 	}
-	// Align.
-	if n := len(b) & 7; n != 0 {
-		b = append(b, []byte("       "[:8-n])...)
-	}
-	var nbArr [8]byte
-	binary.LittleEndian.PutUint64(nbArr[:], uint64(len(b)))
-	if _, err := w.Write(nbArr[:]); err != nil {
-		return err
-	}
 	if _, err := w.Write(b); err != nil {
 		return err
 	}
-	for _, t := range f.Tensors {
+	total := uint64(len(b))
+	for i := range f.Tensors {
+		total += uint64(len(f.Tensors[i].Data))
+	}
+	p := progress{fn: opts.Progress, done: uint64(len(b)), total: total}
+	p.report()
+	for _, i := range order {
+		t := &f.Tensors[i]
 		// TODO: It's unhealthy to not align the data at 8 bytes.
-		if _, err := w.Write(t.Data); err != nil {
-			return err
+		for d := t.Data; len(d) != 0; {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			c := d[:min(len(d), progressChunk)]
+			if _, err := w.Write(c); err != nil {
+				return err
+			}
+			d = d[len(c):]
+			p.add(len(c))
+		}
+	}
+	return ctx.Err()
+}
+
+// encodeHeader returns the encoded header, including the length prefix, and the
+// order in which the tensors' data must be written.
+func (f *File) encodeHeader(opts *SerializeOptions) ([]byte, []int, error) {
+	if opts.Canonical {
+		if opts.HeaderPadding != 0 {
+			return nil, nil, errors.New("canonical: HeaderPadding is not supported")
+		}
+		if opts.Order != OrderHeader {
+			return nil, nil, errors.New("canonical: Order is not supported")
+		}
+		return f.canonicalHeader()
+	}
+	order, err := opts.Order.sortIndexes(f.Tensors)
+	if err != nil {
+		return nil, nil, err
+	}
+	r := safeTensorsHeader{metadata: f.Metadata, rawMetadata: f.RawMetadata, tensors: make([]tensorInfo, len(f.Tensors))}
+	var offset uint64
+	for _, i := range order {
+		if err := f.Tensors[i].Validate(); err != nil {
+			return nil, nil, err
+		}
+		offset = r.tensors[i].fromTensor(&f.Tensors[i], offset)
+	}
+	b, err := r.encode(opts.HeaderPadding)
+	if err != nil {
+		return nil, nil, err
+	}
+	return b, order, nil
+}
+
+// ReadContext reads a whole safetensors file from an io.Reader.
+//
+// The data is read in a single buffer. The context is checked between chunks.
+func ReadContext(ctx context.Context, r io.Reader, opts *LoadOptions) (*File, error) {
+	if opts == nil {
+		opts = &LoadOptions{}
+	}
+	h := safeTensorsHeader{}
+	n, err := h.parseHeaderReader(r, &opts.ParseOptions)
+	if err != nil {
+		return nil, fmt.Errorf("invalid header: %w", err)
+	}
+	bufferEnd, err := h.validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid metadata: %w", err)
+	}
+	if err := opts.checkDataSize(bufferEnd); err != nil {
+		return nil, err
+	}
+	if bufferEnd > math.MaxInt {
+		return nil, errorf(ErrOverflow, "data too large: %d", bufferEnd)
+	}
+	// Do not trust bufferEnd for the allocation, grow the buffer as data is
+	// read.
+	data := []byte{}
+	p := progress{fn: opts.Progress, done: n + 8, total: n + 8 + bufferEnd}
+	p.report()
+	for uint64(len(data)) != bufferEnd {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		l := len(data)
+		c := int(min(bufferEnd-uint64(l), progressChunk))
+		data = slices.Grow(data, c)[:l+c]
+		if _, err := io.ReadFull(r, data[l:]); err != nil {
+			return nil, errorf(ErrTruncated, "metadata incomplete buffer: %w", err)
+		}
+		p.add(c)
+	}
+	f := &File{Metadata: h.metadata, RawMetadata: h.rawMetadata, Tensors: make([]Tensor, len(h.tensors))}
+	for i := range h.tensors {
+		h.tensors[i].toTensor(&f.Tensors[i], data[h.tensors[i].DataOffsets[0]:h.tensors[i].DataOffsets[1]])
+		if err := f.Tensors[i].Validate(); err != nil {
+			return nil, err
 		}
 	}
+	return f, nil
+}
+
+// checkSize verifies that the file size matches the size described by the
+// header.
+func checkSize(want, got uint64) error {
+	if want > got {
+		return errorf(ErrTruncated, "metadata incomplete buffer: %d != %d", want, got)
+	}
+	if want < got {
+		return errorf(ErrTrailingData, "metadata incomplete buffer: %d != %d", want, got)
+	}
 	return nil
 }
 
+// progressChunk is the granularity at which progress is reported and
+// cancellation is checked.
+const progressChunk = 64 << 20
+
+type progress struct {
+	fn    ProgressFunc
+	done  uint64
+	total uint64
+}
+
+func (p *progress) add(n int) {
+	p.done += uint64(n)
+	p.report()
+}
+
+func (p *progress) report() {
+	if p.fn != nil {
+		p.fn(p.done, p.total)
+	}
+}
+
 //
 
 // safeTensorsHeader represents the header of safetensors file.
 type safeTensorsHeader struct {
-	tensors  []tensorInfo
-	metadata map[string]string
+	tensors     []tensorInfo
+	metadata    map[string]string
+	rawMetadata []RawField
+	// opts is used by UnmarshalJSON to enforce limits.
+	opts *ParseOptions
 }
 
 // UnmarshalJSON implements json.Unmarshaler.
@@ -156,8 +410,10 @@ func (h *safeTensorsHeader) UnmarshalJSON(data []byte) error {
 	// Parse the raw JSON to maintain order
 	dec := json.NewDecoder(bytes.NewReader(data))
 	// Read opening brace.
-	if d, err := dec.Token(); err != nil || d != json.Delim('{') {
+	if d, err := dec.Token(); err != nil {
 		return err
+	} else if d != json.Delim('{') {
+		return fmt.Errorf("invalid json; expected object, got %v", d)
 	}
 	for dec.More() {
 		key, err := dec.Token()
@@ -169,15 +425,68 @@ func (h *safeTensorsHeader) UnmarshalJSON(data []byte) error {
 			return fmt.Errorf("invalid json; expected string, got %T", key)
 		}
 		if keyStr == "__metadata__" {
+			if h.opts != nil && h.opts.Lossless {
+				var raw json.RawMessage
+				if err := dec.Decode(&raw); err != nil {
+					return err
+				}
+				if h.rawMetadata, err = rawFields(raw); err != nil {
+					return err
+				}
+				h.metadata = stringFields(h.rawMetadata)
+				if h.opts.Strict && len(h.metadata) != len(h.rawMetadata) {
+					for _, f := range h.rawMetadata {
+						if !isJSONString(f.Value) {
+							return fmt.Errorf("metadata %q: expected string, got %s", f.Key, f.Value)
+						}
+					}
+				}
+				all := make(map[string]string, len(h.rawMetadata))
+				for _, f := range h.rawMetadata {
+					all[f.Key] = string(f.Value)
+				}
+				if err := h.opts.checkMetadata(all); err != nil {
+					return err
+				}
+				continue
+			}
 			if err := dec.Decode(&h.metadata); err != nil {
 				return err
 			}
+			if err := h.opts.checkMetadata(h.metadata); err != nil {
+				return err
+			}
 			continue
 		}
+		if err := h.opts.checkTensors(len(h.tensors) + 1); err != nil {
+			return err
+		}
 		t := tensorInfo{name: keyStr}
-		if err := dec.Decode(&t); err != nil {
+		if h.opts != nil && h.opts.Lossless {
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); err != nil {
+				return err
+			}
+			if err := json.Unmarshal(raw, &t); err != nil {
+				return err
+			}
+			fields, err := rawFields(raw)
+			if err != nil {
+				return err
+			}
+			t.extra = extraFields(fields)
+		} else if err := dec.Decode(&t); err != nil {
 			return err
 		}
+		if t.DType == "" {
+			return &TensorError{Name: t.name, Index: len(h.tensors), Err: errorf(ErrInvalidDType, "missing dtype")}
+		}
+		if t.Shape == nil {
+			return &TensorError{Name: t.name, Index: len(h.tensors), Err: errors.New("missing shape")}
+		}
+		if err := h.opts.checkRank(len(t.Shape)); err != nil {
+			return &TensorError{Name: t.name, Index: len(h.tensors), Err: err}
+		}
 		h.tensors = append(h.tensors, t)
 	}
 	if len(h.tensors) == 0 {
@@ -191,23 +500,41 @@ func (h *safeTensorsHeader) UnmarshalJSON(data []byte) error {
 // It keeps ordering.
 func (h *safeTensorsHeader) MarshalJSON() ([]byte, error) {
 	pairs := make([][]byte, 0, len(h.tensors)+1)
-	if len(h.metadata) != 0 {
-		d, err := json.Marshal(h.metadata)
+	if h.rawMetadata != nil {
+		fields, err := mergeMetadata(h.rawMetadata, h.metadata)
+		if err != nil {
+			return nil, err
+		}
+		if len(fields) != 0 {
+			d, err := appendFields([]byte("\"__metadata__\":{"), fields, false)
+			if err != nil {
+				return nil, err
+			}
+			pairs = append(pairs, append(d, '}'))
+		}
+	} else if len(h.metadata) != 0 {
+		d, err := marshal(h.metadata)
 		if err != nil {
 			return nil, err
 		}
 		pairs = append(pairs, append([]byte("\"__metadata__\":"), d...))
 	}
 	for _, t := range h.tensors {
-		k, err := json.Marshal(t.name)
+		k, err := marshal(t.name)
 		if err != nil {
 			return nil, err
 		}
 		k = append(k, ':')
-		d, err := json.Marshal(t)
+		d, err := marshal(&t)
 		if err != nil {
 			return nil, err
 		}
+		if len(t.extra) != 0 {
+			if d, err = appendFields(d[:len(d)-1], t.extra, true); err != nil {
+				return nil, err
+			}
+			d = append(d, '}')
+		}
 
 		pairs = append(pairs, append(k, d...))
 	}
@@ -223,42 +550,82 @@ func (h *safeTensorsHeader) MarshalJSON() ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
+// encode returns the serialized header, including the length prefix, pad
+// extra spaces and the padding to align the data at 8 bytes.
+func (h *safeTensorsHeader) encode(pad int) ([]byte, error) {
+	b, err := h.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	b = append(b, bytes.Repeat([]byte{' '}, pad)...)
+	// Align.
+	if n := len(b) & 7; n != 0 {
+		b = append(b, []byte("       "[:8-n])...)
+	}
+	out := make([]byte, 8, 8+len(b))
+	binary.LittleEndian.PutUint64(out, uint64(len(b)))
+	return append(out, b...), nil
+}
+
 // parseHeaderBytes parses the header and returns the size of the header + parsed
 // data, given a byte-buffer representing the whole safetensor file.
-func (h *safeTensorsHeader) parseHeaderBytes(buffer []byte) (uint64, error) {
+func (h *safeTensorsHeader) parseHeaderBytes(buffer []byte, opts *ParseOptions) (uint64, error) {
 	bufferLen := uint64(len(buffer))
 	if bufferLen < 8 {
-		return 0, fmt.Errorf("too small (%d bytes)", bufferLen)
+		return 0, &HeaderError{Err: errorf(ErrTruncated, "too small (%d bytes)", bufferLen)}
 	}
 	n := binary.LittleEndian.Uint64(buffer)
-	if n > maxHeaderSize {
-		return 0, fmt.Errorf("too large max %d, actual %d", maxHeaderSize, n)
+	if m := opts.maxHeaderSize(); n > m {
+		return 0, &HeaderError{Err: errorf(ErrHeaderTooLarge, "too large max %d, actual %d", m, n)}
 	}
 	stop := n + 8
 	if stop > bufferLen {
-		return 0, fmt.Errorf("invalid length %d", stop)
+		return 0, &HeaderError{Err: errorf(ErrTruncated, "invalid length %d", stop)}
 	}
-	if err := json.Unmarshal(buffer[8:stop], h); err != nil {
+	if err := h.decode(buffer[8:stop], opts); err != nil {
 		return 0, err
 	}
 	return n, nil
 }
 
+// decode decodes the JSON header.
+func (h *safeTensorsHeader) decode(raw []byte, opts *ParseOptions) error {
+	if opts != nil && opts.Strict {
+		if err := checkStrict(raw); err != nil {
+			return err
+		}
+	}
+	h.opts = opts
+	if err := json.Unmarshal(raw, h); err != nil {
+		var he *HeaderError
+		var te *TensorError
+		if !errors.As(err, &he) && !errors.As(err, &te) {
+			err = &HeaderError{Err: err}
+		}
+		return err
+	}
+	return nil
+}
+
 // parseHeaderReader parses the header.
-func (h *safeTensorsHeader) parseHeaderReader(r io.Reader) (uint64, error) {
+func (h *safeTensorsHeader) parseHeaderReader(r io.Reader, opts *ParseOptions) (uint64, error) {
 	numBytes := [8]byte{}
-	if n, err := r.Read(numBytes[:]); n != len(numBytes) || err != nil {
-		return 0, fmt.Errorf("failed to read: %w", err)
+	if _, err := io.ReadFull(r, numBytes[:]); err != nil {
+		return 0, &HeaderError{Err: errorf(ErrTruncated, "failed to read: %w", err)}
 	}
 	n := binary.LittleEndian.Uint64(numBytes[:])
-	if n > maxHeaderSize {
-		return 0, fmt.Errorf("too large: max %d, actual %d", maxHeaderSize, n)
+	if m := opts.maxHeaderSize(); n > m {
+		return 0, &HeaderError{Err: errorf(ErrHeaderTooLarge, "too large: max %d, actual %d", m, n)}
 	}
-	buf := make([]byte, int(n))
-	if n, err := r.Read(buf); n != len(buf) || err != nil {
-		return 0, fmt.Errorf("failed to read: %w", err)
+	// Do not trust n for the allocation, grow the buffer as data is read.
+	buf := bytes.Buffer{}
+	if _, err := io.CopyN(&buf, r, int64(n)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, &HeaderError{Err: errorf(ErrTruncated, "failed to read: %w", err)}
 	}
-	if err := json.Unmarshal(buf, h); err != nil {
+	if err := h.decode(buf.Bytes(), opts); err != nil {
 		return 0, err
 	}
 	return n, nil
@@ -277,12 +644,14 @@ func (h *safeTensorsHeader) validate() (uint64, error) {
 		indexes[i] = i
 	}
 	sort.Slice(indexes, func(i, j int) bool {
-		return h.tensors[indexes[i]].DataOffsets[0] < h.tensors[indexes[j]].DataOffsets[0]
+		a, b := h.tensors[indexes[i]].DataOffsets, h.tensors[indexes[j]].DataOffsets
+		// Sort empty tensors before the tensor starting at the same offset.
+		return a[0] < b[0] || (a[0] == b[0] && a[1] < b[1])
 	})
 	start := uint64(0)
 	for num, idx := range indexes {
 		if err := h.tensors[idx].validate(start); err != nil {
-			return 0, fmt.Errorf("tensor %q #%d: %w", h.tensors[idx].name, num, err)
+			return 0, &TensorError{Name: h.tensors[idx].name, Index: num, Offsets: h.tensors[idx].DataOffsets, Err: err}
 		}
 		start = h.tensors[idx].DataOffsets[1]
 	}
@@ -302,6 +671,8 @@ type tensorInfo struct {
 	// DataOffsets provides the offsets to find the data
 	// within the byte-buffer array.
 	DataOffsets [2]uint64 `json:"data_offsets"`
+	// extra are the unknown fields, only kept in lossless mode.
+	extra []RawField
 }
 
 func (t *tensorInfo) toTensor(dst *Tensor, data []byte) {
@@ -309,12 +680,18 @@ func (t *tensorInfo) toTensor(dst *Tensor, data []byte) {
 	dst.DType = t.DType
 	dst.Shape = t.Shape
 	dst.Data = data
+	dst.Extra = t.extra
 }
 
 func (t *tensorInfo) fromTensor(src *Tensor, offset uint64) uint64 {
 	t.name = src.Name
 	t.DType = src.DType
 	t.Shape = src.Shape
+	t.extra = src.Extra
+	if t.Shape == nil {
+		// Encode as [] instead of null.
+		t.Shape = []uint64{}
+	}
 	t.DataOffsets[0] = offset
 	offset += uint64(len(src.Data))
 	t.DataOffsets[1] = offset
@@ -324,46 +701,44 @@ func (t *tensorInfo) fromTensor(src *Tensor, offset uint64) uint64 {
 func (t *tensorInfo) validate(start uint64) error {
 	// TODO: We should allow empty space for 8 bytes alignment.
 	if t.DataOffsets[0] != start {
-		return fmt.Errorf("invalid offset start: expected %d, got %d", start, t.DataOffsets[0])
+		return errorf(ErrOffsetMismatch, "invalid offset start: expected %d, got %d", start, t.DataOffsets[0])
 	}
 	if t.DataOffsets[1] < start {
-		return fmt.Errorf("invalid offset end: %d < %d", t.DataOffsets[1], start)
+		return errorf(ErrOffsetMismatch, "invalid offset end: %d < %d", t.DataOffsets[1], start)
 	}
-	numElements := uint64(1)
-	for _, v := range t.Shape {
-		var err error
-		if numElements, err = checkedMul(numElements, v); err != nil {
-			return fmt.Errorf("failed to compute num elements from shape: %w", err)
-		}
-	}
-	numBytes, err := checkedMul(numElements, t.DType.WordSize())
+	numBytes, err := byteSize(t.DType, t.Shape)
 	if err != nil {
-		return fmt.Errorf("failed to compute num bytes from num elements: %w", err)
+		return err
 	}
 	if got := t.DataOffsets[1] - start; got != numBytes {
-		return fmt.Errorf("info data offsets mismatch: expected %d, got %d", numBytes, got)
+		return errorf(ErrOffsetMismatch, "info data offsets mismatch: expected %d, got %d", numBytes, got)
 	}
 	return nil
 }
 
 const maxHeaderSize = 100_000_000
 
-func numElementsFromShape(shape []uint64) uint64 {
-	if len(shape) == 0 {
-		return 1
+// byteSize returns the number of bytes of a tensor, checking for overflow.
+func byteSize(dtype DType, shape []uint64) (uint64, error) {
+	numElements := uint64(1)
+	for _, v := range shape {
+		var err error
+		if numElements, err = checkedMul(numElements, v); err != nil {
+			return 0, fmt.Errorf("failed to compute num elements from shape: %w", err)
+		}
 	}
-	n := shape[0]
-	for _, v := range shape[1:] {
-		n *= v
+	numBytes, err := checkedMul(numElements, dtype.WordSize())
+	if err != nil {
+		return 0, fmt.Errorf("failed to compute num bytes from num elements: %w", err)
 	}
-	return n
+	return numBytes, nil
 }
 
 // checkedMul multiplies a and b and checks for overflow.
 func checkedMul(a, b uint64) (uint64, error) {
 	c := a * b
 	if a > 1 && b > 1 && c/a != b {
-		return c, fmt.Errorf("multiplication overflow: %d * %d", a, b)
+		return c, errorf(ErrOverflow, "multiplication overflow: %d * %d", a, b)
 	}
 	return c, nil
 }
@@ -7,11 +7,15 @@ package safetensors
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
 	"math"
 	"strconv"
 	"testing"
+	"testing/iotest"
 
 	"github.com/google/go-cmp/cmp"
 )
@@ -164,6 +168,49 @@ func TestEmptyShapesAllowed(t *testing.T) {
 	}
 }
 
+func TestParse_TrailingWhitespace(t *testing.T) {
+	for _, ws := range []string{"", " ", "        ", "\t\r\n  "} {
+		hdr := `{"test":{"dtype":"U8","shape":[1],"data_offsets":[0,1]}}` + ws
+		d := binary.LittleEndian.AppendUint64(nil, uint64(len(hdr)))
+		d = append(append(d, hdr...), 42)
+		f, err := Parse(d)
+		if err != nil {
+			t.Fatalf("%q: %s", ws, err)
+		}
+		if f.Tensors[0].Data[0] != 42 {
+			t.Fatal(f.Tensors[0].Data)
+		}
+	}
+}
+
+func TestSerialize_HeaderPadding(t *testing.T) {
+	f := makeTestFile(2)
+	want := bytes.Buffer{}
+	if err := f.Serialize(&want); err != nil {
+		t.Fatal(err)
+	}
+	got := bytes.Buffer{}
+	if err := f.SerializeContext(context.Background(), &got, &SerializeOptions{HeaderPadding: 100}); err != nil {
+		t.Fatal(err)
+	}
+	if d := got.Len() - want.Len(); d < 100 || d >= 108 {
+		t.Fatal(d)
+	}
+	if got.Len()%8 != want.Len()%8 {
+		t.Fatal("misaligned")
+	}
+	f2, err := Parse(got.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(f, f2); diff != "" {
+		t.Fatalf("(-want,+got)\n%s", diff)
+	}
+	if err := f.SerializeContext(context.Background(), io.Discard, &SerializeOptions{HeaderPadding: -1}); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
 func TestZeroSizedTensor(t *testing.T) {
 	d := []byte("<\x00\x00\x00\x00\x00\x00\x00" +
 		`{"test":{"dtype":"I32","shape":[2,0],"data_offsets":[0, 0]}}`)
@@ -267,6 +314,53 @@ func TestParse_Errors(t *testing.T) {
 	}
 }
 
+func TestSerializeContext(t *testing.T) {
+	f := makeTestFile(3)
+	var calls [][2]uint64
+	buf := bytes.Buffer{}
+	opts := SerializeOptions{Progress: func(done, total uint64) { calls = append(calls, [2]uint64{done, total}) }}
+	if err := f.SerializeContext(context.Background(), &buf, &opts); err != nil {
+		t.Fatal(err)
+	}
+	l := uint64(buf.Len())
+	want := [][2]uint64{{l - 24, l}, {l - 16, l}, {l - 8, l}, {l, l}}
+	if diff := cmp.Diff(want, calls); diff != "" {
+		t.Fatalf("(-want,+got)\n%s", diff)
+	}
+	got, err := ReadContext(context.Background(), iotest.OneByteReader(bytes.NewReader(buf.Bytes())), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(f, got); diff != "" {
+		t.Fatalf("(-want,+got)\n%s", diff)
+	}
+}
+
+func TestSerializeContext_Cancel(t *testing.T) {
+	f := makeTestFile(3)
+	ctx, cancel := context.WithCancel(context.Background())
+	opts := SerializeOptions{Progress: func(done, total uint64) { cancel() }}
+	if err := f.SerializeContext(ctx, io.Discard, &opts); !errors.Is(err, context.Canceled) {
+		t.Fatal(err)
+	}
+}
+
+func TestReadContext_Errors(t *testing.T) {
+	buf := bytes.Buffer{}
+	if err := makeTestFile(3).Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	d := buf.Bytes()
+	if _, err := ReadContext(context.Background(), bytes.NewReader(d[:len(d)-1]), nil); err == nil || err.Error() != "metadata incomplete buffer: unexpected EOF" {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ReadContext(ctx, bytes.NewReader(d), nil); !errors.Is(err, context.Canceled) {
+		t.Fatal(err)
+	}
+}
+
 func Test_CheckedMul(t *testing.T) {
 	const max = math.MaxUint64
 
@@ -0,0 +1,159 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package safetensors
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server is an http.Handler serving the safetensors files in a directory.
+//
+// It handles:
+//   - GET /files: JSON list of the ".safetensors" files' names.
+//   - GET /files/{name}/header: the JSON header of the file.
+//   - GET /files/{name}/tensors/{tensor}: the tensor's raw data, with Range
+//     and conditional requests support. The ETag is the SHA-256 of the data.
+//
+// Files are memory mapped on first access and stay mapped until Close. They
+// must not be modified while being served.
+type Server struct {
+	dir   string
+	mux   http.ServeMux
+	mu    sync.Mutex
+	files map[string]*servedFile
+}
+
+type servedFile struct {
+	m     Mapped
+	mu    sync.Mutex
+	etags map[string]string
+}
+
+// NewServer returns a Server serving the files in dir.
+func NewServer(dir string) *Server {
+	s := &Server{dir: dir, files: map[string]*servedFile{}}
+	s.mux.HandleFunc("GET /files", s.serveList)
+	s.mux.HandleFunc("GET /files/{name}/header", s.serveHeader)
+	s.mux.HandleFunc("GET /files/{name}/tensors/{tensor...}", s.serveTensor)
+	return s
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Close unmaps all the files. The Server must not be used afterward.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var errs []error
+	for _, f := range s.files {
+		errs = append(errs, f.m.Close())
+	}
+	clear(s.files)
+	return errors.Join(errs...)
+}
+
+func (s *Server) serveList(w http.ResponseWriter, r *http.Request) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		http.Error(w, "failed to list files", http.StatusInternalServerError)
+		return
+	}
+	names := []string{}
+	for _, e := range entries {
+		if e.Type().IsRegular() && isServedName(e.Name()) {
+			names = append(names, e.Name())
+		}
+	}
+	b, _ := marshal(names)
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(b)
+}
+
+func (s *Server) serveHeader(w http.ResponseWriter, r *http.Request) {
+	f := s.open(w, r.PathValue("name"))
+	if f == nil {
+		return
+	}
+	n := binary.LittleEndian.Uint64(f.m.m)
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(bytes.TrimRight(f.m.m[8:8+n], " "))
+}
+
+func (s *Server) serveTensor(w http.ResponseWriter, r *http.Request) {
+	f := s.open(w, r.PathValue("name"))
+	if f == nil {
+		return
+	}
+	name := r.PathValue("tensor")
+	i := slices.IndexFunc(f.m.Tensors, func(t Tensor) bool { return t.Name == name })
+	if i == -1 {
+		http.Error(w, "tensor not found", http.StatusNotFound)
+		return
+	}
+	t := &f.m.Tensors[i]
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("ETag", f.etag(t))
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(t.Data))
+}
+
+// open returns the mapped file or writes an error.
+func (s *Server) open(w http.ResponseWriter, name string) *servedFile {
+	if !isServedName(name) {
+		http.Error(w, "file not found", http.StatusNotFound)
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f := s.files[name]; f != nil {
+		return f
+	}
+	f := &servedFile{etags: map[string]string{}}
+	if err := f.m.Open(filepath.Join(s.dir, name)); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			http.Error(w, "file not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "invalid file", http.StatusInternalServerError)
+		}
+		return nil
+	}
+	s.files[name] = f
+	return f
+}
+
+// etag returns the quoted SHA-256 of the tensor's data, computing it once.
+func (f *servedFile) etag(t *Tensor) string {
+	f.mu.Lock()
+	e, ok := f.etags[t.Name]
+	f.mu.Unlock()
+	if !ok {
+		h := sha256.Sum256(t.Data)
+		e = "\"" + hex.EncodeToString(h[:]) + "\""
+		f.mu.Lock()
+		f.etags[t.Name] = e
+		f.mu.Unlock()
+	}
+	return e
+}
+
+// isServedName returns true if name is a file name that can be served.
+func isServedName(name string) bool {
+	return strings.HasSuffix(name, ".safetensors") && !strings.HasPrefix(name, ".") &&
+		!strings.ContainsAny(name, `/\`)
+}
@@ -0,0 +1,95 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package safetensors
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestServer(t *testing.T) {
+	dir := t.TempDir()
+	f := makeTestFile(3)
+	f.Tensors[1].Name = "model/w"
+	if err := WriteFile(filepath.Join(dir, "a.safetensors"), f, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "b.txt"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(dir)
+	defer s.Close()
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	get := func(path string, hdr ...string) (*http.Response, string) {
+		req, err := http.NewRequest("GET", ts.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < len(hdr); i += 2 {
+			req.Header.Set(hdr[i], hdr[i+1])
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp, string(b)
+	}
+
+	if resp, body := get("/files"); resp.StatusCode != 200 || body != `["a.safetensors"]` {
+		t.Fatalf("%d %q", resp.StatusCode, body)
+	}
+	want := `{"t0":{"dtype":"F32","shape":[2],"data_offsets":[0,8]},` +
+		`"model/w":{"dtype":"F32","shape":[2],"data_offsets":[8,16]},` +
+		`"t2":{"dtype":"F32","shape":[2],"data_offsets":[16,24]}}`
+	if resp, body := get("/files/a.safetensors/header"); resp.StatusCode != 200 || body != want {
+		t.Fatalf("%d %q", resp.StatusCode, body)
+	}
+	resp, body := get("/files/a.safetensors/tensors/model/w")
+	if resp.StatusCode != 200 || body != string(f.Tensors[1].Data) || resp.ContentLength != 8 {
+		t.Fatalf("%d %q", resp.StatusCode, body)
+	}
+	etag := resp.Header.Get("ETag")
+	if etag == "" {
+		t.Fatal("missing ETag")
+	}
+	if resp, body := get("/files/a.safetensors/tensors/t2", "Range", "bytes=4-7"); resp.StatusCode != 206 || body != string(f.Tensors[2].Data[4:]) {
+		t.Fatalf("%d %q", resp.StatusCode, body)
+	}
+	if resp, _ := get("/files/a.safetensors/tensors/model/w", "If-None-Match", etag); resp.StatusCode != 304 {
+		t.Fatal(resp.StatusCode)
+	}
+	for _, p := range []string{"/files/b.txt/header", "/files/c.safetensors/header", "/files/a.safetensors/tensors/missing", "/files/..safetensors/header"} {
+		if resp, _ := get(p); resp.StatusCode != 404 {
+			t.Fatalf("%s: %d", p, resp.StatusCode)
+		}
+	}
+
+	// Works with HTTPReader.
+	h, err := NewHTTPReader(context.Background(), ts.URL+"/files/a.safetensors/tensors/t0", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 8)
+	if _, err := h.ReadAt(b, 0); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(f.Tensors[0].Data, b); diff != "" {
+		t.Fatalf("(-want,+got)\n%s", diff)
+	}
+}
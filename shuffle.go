@@ -0,0 +1,107 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package safetensors
+
+import (
+	"fmt"
+	"io"
+)
+
+// Shuffle writes src, a sequence of little endian elements of dtype, to dst
+// grouped by byte plane: the first byte of every element, then the second byte
+// of every element, and so on.
+//
+// Bytes of equal significance are much more alike than adjacent bytes, e.g.
+// the exponent bytes of BF16 values, so the shuffled data compresses
+// significantly better. dst and src must have the same length and must not
+// overlap. Unshuffle reverts it.
+func (dt DType) Shuffle(dst, src []byte) error {
+	w, err := dt.checkPlanes(dst, src)
+	if err != nil {
+		return err
+	}
+	n := len(src) / w
+	for p := range w {
+		plane := dst[p*n : (p+1)*n]
+		for i := range plane {
+			plane[i] = src[i*w+p]
+		}
+	}
+	return nil
+}
+
+// Unshuffle reverts Shuffle.
+func (dt DType) Unshuffle(dst, src []byte) error {
+	w, err := dt.checkPlanes(dst, src)
+	if err != nil {
+		return err
+	}
+	n := len(src) / w
+	for p := range w {
+		plane := src[p*n : (p+1)*n]
+		for i, b := range plane {
+			dst[i*w+p] = b
+		}
+	}
+	return nil
+}
+
+func (dt DType) checkPlanes(dst, src []byte) (int, error) {
+	w := int(dt.WordSize())
+	if w == 0 {
+		return 0, errorf(ErrInvalidDType, "%q is not a valid DType", dt)
+	}
+	if len(dst) != len(src) || len(src)%w != 0 {
+		return 0, errorf(ErrShapeMismatch, "invalid lengths %d and %d for %s", len(dst), len(src), dt)
+	}
+	return w, nil
+}
+
+// shuffleBlock is the size of the blocks independently shuffled in the
+// compressed container, to bound the memory used.
+const shuffleBlock = 1 << 20
+
+// unshuffleWriter unshuffles the data written to it by blocks of
+// shuffleBlock bytes.
+type unshuffleWriter struct {
+	w   io.Writer
+	dt  DType
+	buf []byte
+	out []byte
+}
+
+func (u *unshuffleWriter) Write(p []byte) (int, error) {
+	if u.buf == nil {
+		u.buf = make([]byte, 0, shuffleBlock)
+		u.out = make([]byte, shuffleBlock)
+	}
+	n := 0
+	for len(p) != 0 {
+		c := min(len(p), shuffleBlock-len(u.buf))
+		u.buf = append(u.buf, p[:c]...)
+		p = p[c:]
+		n += c
+		if len(u.buf) == shuffleBlock {
+			if err := u.Flush(); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// Flush unshuffles and writes the pending partial block.
+func (u *unshuffleWriter) Flush() error {
+	if len(u.buf) == 0 {
+		return nil
+	}
+	out := u.out[:len(u.buf)]
+	if err := u.dt.Unshuffle(out, u.buf); err != nil {
+		return fmt.Errorf("compressed: %w", err)
+	}
+	u.buf = u.buf[:0]
+	_, err := u.w.Write(out)
+	return err
+}
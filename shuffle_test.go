@@ -0,0 +1,162 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package safetensors
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/rand/v2"
+	"sync"
+	"testing"
+)
+
+func TestDType_Shuffle(t *testing.T) {
+	src := []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+	data := []struct {
+		dt   DType
+		want []byte
+	}{
+		{U8, src},
+		{BF16, []byte{0, 2, 4, 6, 8, 10, 12, 14, 1, 3, 5, 7, 9, 11, 13, 15}},
+		{F32, []byte{0, 4, 8, 12, 1, 5, 9, 13, 2, 6, 10, 14, 3, 7, 11, 15}},
+		{F64, []byte{0, 8, 1, 9, 2, 10, 3, 11, 4, 12, 5, 13, 6, 14, 7, 15}},
+	}
+	for _, line := range data {
+		got := make([]byte, len(src))
+		if err := line.dt.Shuffle(got, src); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(line.want, got) {
+			t.Fatalf("%s: %v", line.dt, got)
+		}
+		back := make([]byte, len(src))
+		if err := line.dt.Unshuffle(back, got); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(src, back) {
+			t.Fatalf("%s: %v", line.dt, back)
+		}
+	}
+	if err := F32.Shuffle(make([]byte, 6), make([]byte, 6)); !errors.Is(err, ErrShapeMismatch) {
+		t.Fatal(err)
+	}
+	if err := F32.Shuffle(make([]byte, 4), make([]byte, 8)); !errors.Is(err, ErrShapeMismatch) {
+		t.Fatal(err)
+	}
+	if err := DType("X").Unshuffle(nil, nil); !errors.Is(err, ErrInvalidDType) {
+		t.Fatal(err)
+	}
+}
+
+func TestSerializeCompressed_Shuffle(t *testing.T) {
+	// Larger than shuffleBlock with a partial last block.
+	const n = shuffleBlock/2 + 3
+	r := rand.New(rand.NewPCG(1, 2))
+	tensor := Tensor{Name: "w", DType: BF16, Shape: []uint64{n}, Data: make([]byte, 2*n)}
+	for i := range n {
+		BF16.encode(tensor.Data[2*i:], r.NormFloat64()*0.02)
+	}
+	f := &File{Tensors: []Tensor{tensor, {Name: "ids", DType: U8, Shape: []uint64{3}, Data: []byte{1, 2, 3}}}}
+	sizes := map[bool]int{}
+	for _, shuffle := range []bool{false, true} {
+		out := bytes.Buffer{}
+		if err := f.SerializeCompressed(context.Background(), &out, &CompressOptions{Shuffle: shuffle}); err != nil {
+			t.Fatal(err)
+		}
+		sizes[shuffle] = out.Len()
+		c, err := OpenCompressed(bytes.NewReader(out.Bytes()), int64(out.Len()), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Load(); err != nil {
+			t.Fatal(err)
+		}
+		for i := range f.Tensors {
+			if !bytes.Equal(f.Tensors[i].Data, c.Tensors[i].Data) {
+				t.Fatalf("%t: %s mismatch", shuffle, f.Tensors[i].Name)
+			}
+		}
+		raw := bytes.Buffer{}
+		if err := f.Serialize(&raw); err != nil {
+			t.Fatal(err)
+		}
+		got := bytes.Buffer{}
+		if err := c.Decompress(context.Background(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(raw.Bytes(), got.Bytes()) {
+			t.Fatalf("%t: decompressed file mismatch", shuffle)
+		}
+	}
+	if sizes[true] >= sizes[false] {
+		t.Fatalf("shuffle didn't help: %v", sizes)
+	}
+}
+
+// fileGPT2Random is fileGPT2 with normally distributed weights, since
+// compressing zeros is not representative.
+var fileGPT2Random = sync.OnceValue(func() *File {
+	r := rand.New(rand.NewPCG(1, 2))
+	f := &File{Tensors: make([]Tensor, len(fileGPT2.Tensors))}
+	for i, t := range fileGPT2.Tensors {
+		t.Data = make([]byte, len(t.Data))
+		for j := 0; j < len(t.Data); j += 4 {
+			F32.encode(t.Data[j:], r.NormFloat64()*0.02)
+		}
+		f.Tensors[i] = t
+	}
+	return f
+})
+
+func BenchmarkGPT2_Shuffle(b *testing.B) {
+	f := fileGPT2Random()
+	dst := make([]byte, len(f.Tensors[0].Data))
+	b.SetBytes(int64(len(dst)))
+	b.ResetTimer()
+	for range b.N {
+		if err := F32.Shuffle(dst, f.Tensors[0].Data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGPT2_Unshuffle(b *testing.B) {
+	f := fileGPT2Random()
+	dst := make([]byte, len(f.Tensors[0].Data))
+	b.SetBytes(int64(len(dst)))
+	b.ResetTimer()
+	for range b.N {
+		if err := F32.Unshuffle(dst, f.Tensors[0].Data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGPT2_Compress(b *testing.B) {
+	benchmarkCompress(b, false)
+}
+
+func BenchmarkGPT2_CompressShuffle(b *testing.B) {
+	benchmarkCompress(b, true)
+}
+
+func benchmarkCompress(b *testing.B, shuffle bool) {
+	f := fileGPT2Random()
+	var total int64
+	for _, t := range f.Tensors {
+		total += int64(len(t.Data))
+	}
+	out := bytes.Buffer{}
+	b.SetBytes(total)
+	b.ResetTimer()
+	for range b.N {
+		out.Reset()
+		if err := f.SerializeCompressed(context.Background(), &out, &CompressOptions{Shuffle: shuffle}); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(out.Len())/float64(total), "ratio")
+}
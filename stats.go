@@ -0,0 +1,120 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package safetensors
+
+import (
+	"context"
+	"math"
+)
+
+// Stats are the statistics of the values of a floating point tensor.
+type Stats struct {
+	// Count is the number of elements.
+	Count uint64
+	// NaN, Inf and Zero are the number of elements with these values.
+	NaN  uint64
+	Inf  uint64
+	Zero uint64
+	// Min, Max, Mean and Std (population standard deviation) are computed on
+	// the finite values only. They are zero when there is no finite value.
+	Min  float64
+	Max  float64
+	Mean float64
+	Std  float64
+	// Histogram is the number of finite values in each equal width bin
+	// between Min and Max inclusively.
+	Histogram []uint64
+}
+
+// Finite returns true if there is no NaN nor infinity.
+func (s *Stats) Finite() bool {
+	return s.NaN == 0 && s.Inf == 0
+}
+
+// Stats returns the statistics of the tensor's values with a histogram of bins
+// bins. The dtype must be a floating point type.
+func (t *Tensor) Stats(bins int) (*Stats, error) {
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+	if !t.DType.IsFloat() {
+		return nil, errorf(ErrInvalidDType, "%q is not a floating point DType", t.DType)
+	}
+	if bins <= 0 {
+		bins = 1
+	}
+	w := t.DType.WordSize()
+	s := &Stats{Count: uint64(len(t.Data)) / w, Histogram: make([]uint64, bins), Min: math.Inf(1), Max: math.Inf(-1)}
+	for i := uint64(0); i < uint64(len(t.Data)); i += w {
+		v := t.DType.decode(t.Data[i:])
+		switch {
+		case math.IsNaN(v):
+			s.NaN++
+			continue
+		case math.IsInf(v, 0):
+			s.Inf++
+			continue
+		case v == 0:
+			s.Zero++
+		}
+		s.Min = min(s.Min, v)
+		s.Max = max(s.Max, v)
+	}
+	n := float64(s.Count - s.NaN - s.Inf)
+	if n == 0 {
+		s.Min, s.Max = 0, 0
+		return s, nil
+	}
+	// Values are scaled to [-1, 1] so the intermediate results can't overflow
+	// with extreme F64 values.
+	scale := max(math.Abs(s.Min), math.Abs(s.Max))
+	if scale == 0 {
+		scale = 1
+	}
+	// Halves are used so Max-Min can't overflow.
+	lo, width := s.Min/2, s.Max/2-s.Min/2
+	// Welford's algorithm for a numerically stable variance.
+	var k, mean, m2 float64
+	for i := uint64(0); i < uint64(len(t.Data)); i += w {
+		v := t.DType.decode(t.Data[i:])
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			continue
+		}
+		k++
+		x := v / scale
+		d := x - mean
+		mean += d / k
+		m2 += d * (x - mean)
+		b := 0
+		if width > 0 {
+			// NaN can't happen but converts to bin 0 anyway.
+			if f := (v/2 - lo) / width * float64(bins); f > 0 {
+				b = min(int(f), bins-1)
+			}
+		}
+		s.Histogram[b]++
+	}
+	s.Mean = mean * scale
+	s.Std = math.Sqrt(m2/n) * scale
+	return s, nil
+}
+
+// Stats returns the statistics of each floating point tensor concurrently, in
+// tensor order. The entry is nil for the other tensors. See Tensor.Stats.
+func (f *File) Stats(ctx context.Context, opts *ParallelOptions, bins int) ([]*Stats, error) {
+	out := make([]*Stats, len(f.Tensors))
+	err := f.ForEach(ctx, opts, func(i int, t *Tensor) error {
+		if !t.DType.IsFloat() {
+			return nil
+		}
+		var err error
+		out[i], err = t.Stats(bins)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
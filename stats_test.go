@@ -0,0 +1,94 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package safetensors
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTensor_Stats(t *testing.T) {
+	values := []float64{0, 1, 2, 3, math.NaN(), math.Inf(-1), 0, 4}
+	for _, dt := range []DType{F8_E5M2, F8_E4M3, F16, BF16, F32, F64} {
+		w := dt.WordSize()
+		tensor := Tensor{Name: "x", DType: dt, Shape: []uint64{uint64(len(values))}, Data: make([]byte, uint64(len(values))*w)}
+		for i, v := range values {
+			dt.encode(tensor.Data[uint64(i)*w:], v)
+		}
+		got, err := tensor.Stats(4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := &Stats{
+			Count: 8, NaN: 1, Inf: 1, Zero: 2,
+			Min: 0, Max: 4, Mean: 10. / 6, Std: math.Sqrt(20. / 9),
+			Histogram: []uint64{2, 1, 1, 2},
+		}
+		if dt == F8_E4M3 {
+			// No infinity, it becomes NaN.
+			want.NaN, want.Inf = 2, 0
+		}
+		if diff := cmp.Diff(want, got, cmp.Comparer(func(a, b float64) bool { return math.Abs(a-b) < 1e-9 })); diff != "" {
+			t.Fatalf("%s: (-want,+got)\n%s", dt, diff)
+		}
+		if got.Finite() {
+			t.Fatal(dt)
+		}
+	}
+}
+
+func TestTensor_Stats_Errors(t *testing.T) {
+	tensor := Tensor{Name: "x", DType: I32, Shape: []uint64{1}, Data: make([]byte, 4)}
+	if _, err := tensor.Stats(1); !errors.Is(err, ErrInvalidDType) {
+		t.Fatal(err)
+	}
+	tensor = Tensor{Name: "x", DType: F32, Shape: []uint64{1}, Data: make([]byte, 4)}
+	F32.encode(tensor.Data, math.NaN())
+	s, err := tensor.Stats(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(&Stats{Count: 1, NaN: 1, Histogram: []uint64{0, 0}}, s); diff != "" {
+		t.Fatalf("(-want,+got)\n%s", diff)
+	}
+}
+
+func TestFile_Stats(t *testing.T) {
+	f := makeTestFile(5)
+	f.Tensors = append(f.Tensors, Tensor{Name: "ids", DType: I32, Shape: []uint64{1}, Data: make([]byte, 4)})
+	got, err := f.Stats(context.Background(), nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got[5] != nil {
+		t.Fatal("expected nil")
+	}
+	if s := got[3]; s.Min != -3 || s.Max != 3 || s.Mean != 0 || s.Std != 3 || !s.Finite() {
+		t.Fatalf("%+v", s)
+	}
+}
+
+func TestTensor_Stats_Extreme(t *testing.T) {
+	tensor := makeFloats("x", F64, []uint64{4}, -1e308, 1e308, math.MaxFloat64, -math.MaxFloat64)
+	s, err := tensor.Stats(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Stats{
+		Count: 4, Min: -math.MaxFloat64, Max: math.MaxFloat64, Mean: 0,
+		Std:       math.Sqrt((1e308/math.MaxFloat64)*(1e308/math.MaxFloat64)/2+0.5) * math.MaxFloat64,
+		Histogram: []uint64{2, 0, 0, 2},
+	}
+	if diff := cmp.Diff(want, s, cmp.Comparer(func(a, b float64) bool { return a == b || math.Abs(a-b) <= 1e-12*math.Abs(a) })); diff != "" {
+		t.Fatalf("(-want,+got)\n%s", diff)
+	}
+	if !s.Finite() {
+		t.Fatal("expected finite")
+	}
+}
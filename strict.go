@@ -0,0 +1,125 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package safetensors
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+// checkStrict implements the checks of ParseOptions.Strict on the raw JSON
+// header.
+func checkStrict(raw []byte) error {
+	if !utf8.Valid(raw) {
+		return &HeaderError{Err: errors.New("not valid UTF-8")}
+	}
+	if len(raw) == 0 || raw[0] != '{' {
+		return &HeaderError{Err: errors.New("must start with '{'")}
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if _, err := dec.Token(); err != nil {
+		return &HeaderError{Err: err}
+	}
+	seen := map[string]struct{}{}
+	for i := 0; dec.More(); {
+		key, err := dec.Token()
+		if err != nil {
+			return &HeaderError{Err: err}
+		}
+		name, _ := key.(string)
+		_, dup := seen[name]
+		seen[name] = struct{}{}
+		if name == "__metadata__" {
+			if dup {
+				return &HeaderError{Err: errorf(ErrDuplicateName, "duplicate \"__metadata__\"")}
+			}
+			if err := skipValue(dec); err != nil {
+				return &HeaderError{Err: err}
+			}
+			continue
+		}
+		if dup {
+			return &TensorError{Name: name, Index: i, Err: errorf(ErrDuplicateName, "duplicate tensor name")}
+		}
+		if err := checkTensorEntry(dec); err != nil {
+			return &TensorError{Name: name, Index: i, Err: err}
+		}
+		i++
+	}
+	return nil
+}
+
+// checkTensorEntry consumes a tensor entry and verifies that the fields are
+// present with their exact case, since encoding/json matches field names
+// case-insensitively.
+func checkTensorEntry(dec *json.Decoder) error {
+	if tok, err := dec.Token(); err != nil {
+		return err
+	} else if tok != json.Delim('{') {
+		return fmt.Errorf("expected object, got %v", tok)
+	}
+	seen := map[string]struct{}{}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		k, _ := key.(string)
+		if _, ok := seen[k]; ok {
+			return errorf(ErrDuplicateName, "duplicate key %q", k)
+		}
+		seen[k] = struct{}{}
+		if err := skipValue(dec); err != nil {
+			return err
+		}
+	}
+	for _, k := range []string{"dtype", "shape", "data_offsets"} {
+		if _, ok := seen[k]; !ok {
+			return fmt.Errorf("missing field %q", k)
+		}
+	}
+	_, err := dec.Token()
+	return err
+}
+
+// skipValue consumes the next JSON value and returns an error if it contains
+// a duplicate object key.
+func skipValue(dec *json.Decoder) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	switch tok {
+	case json.Delim('{'):
+		seen := map[string]struct{}{}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			k, _ := key.(string)
+			if _, ok := seen[k]; ok {
+				return errorf(ErrDuplicateName, "duplicate key %q", k)
+			}
+			seen[k] = struct{}{}
+			if err := skipValue(dec); err != nil {
+				return err
+			}
+		}
+	case json.Delim('['):
+		for dec.More() {
+			if err := skipValue(dec); err != nil {
+				return err
+			}
+		}
+	default:
+		return nil
+	}
+	_, err = dec.Token()
+	return err
+}
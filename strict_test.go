@@ -0,0 +1,108 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package safetensors
+
+import (
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func makeRaw(hdr string, data int) []byte {
+	d := binary.LittleEndian.AppendUint64(nil, uint64(len(hdr)))
+	return append(append(d, hdr...), make([]byte, data)...)
+}
+
+func TestParse_Strict(t *testing.T) {
+	data := []struct {
+		name   string
+		in     []byte
+		err    string
+		tensor string
+	}{
+		{
+			"leading whitespace",
+			makeRaw(` {"a":{"dtype":"U8","shape":[1],"data_offsets":[0,1]}}`, 1),
+			"invalid header: must start with '{'",
+			"",
+		},
+		{
+			"invalid UTF-8",
+			makeRaw("{\"a\xff\":{\"dtype\":\"U8\",\"shape\":[1],\"data_offsets\":[0,1]}}", 1),
+			"invalid header: not valid UTF-8",
+			"",
+		},
+		{
+			"duplicate tensor",
+			makeRaw(`{"a":{"dtype":"U8","shape":[1],"data_offsets":[0,1]},"a":{"dtype":"U8","shape":[1],"data_offsets":[1,2]}}`, 2),
+			"invalid header: tensor \"a\" #1: duplicate tensor name",
+			"a",
+		},
+		{
+			"duplicate field",
+			makeRaw(`{"a":{"dtype":"U8","dtype":"I8","shape":[1],"data_offsets":[0,1]}}`, 1),
+			"invalid header: tensor \"a\" #0: duplicate key \"dtype\"",
+			"a",
+		},
+		{
+			"duplicate metadata",
+			makeRaw(`{"__metadata__":{},"a":{"dtype":"U8","shape":[1],"data_offsets":[0,1]},"__metadata__":{}}`, 1),
+			"invalid header: duplicate \"__metadata__\"",
+			"",
+		},
+		{
+			"case insensitive fields",
+			makeRaw(`{"a":{"DType":"U8","shape":[1],"data_offsets":[0,1]}}`, 1),
+			"invalid header: tensor \"a\" #0: missing field \"dtype\"",
+			"a",
+		},
+		{
+			"duplicate metadata key",
+			makeRaw(`{"__metadata__":{"k":"1","k":"2"},"a":{"dtype":"U8","shape":[1],"data_offsets":[0,1]}}`, 1),
+			"invalid header: duplicate key \"k\"",
+			"",
+		},
+	}
+	for i, line := range data {
+		t.Run(strconv.Itoa(i)+": "+line.name, func(t *testing.T) {
+			if _, err := Parse(line.in); err != nil {
+				t.Fatalf("lenient mode must accept: %s", err)
+			}
+			_, err := ParseWithOptions(line.in, &ParseOptions{Strict: true})
+			if err == nil || err.Error() != line.err {
+				t.Fatalf("Invalid error\nwant: %s\ngot:  %s", line.err, err)
+			}
+			var te *TensorError
+			var he *HeaderError
+			if line.tensor != "" {
+				if !errors.As(err, &te) || te.Name != line.tensor {
+					t.Fatalf("%#v", err)
+				}
+			} else if !errors.As(err, &he) {
+				t.Fatalf("%#v", err)
+			}
+		})
+	}
+}
+
+func TestParse_StrictValid(t *testing.T) {
+	d := makeRaw(`{"__metadata__":{"k":"v"},"a":{"dtype":"U8","shape":[1],"data_offsets":[0,1]}}  `, 1)
+	if _, err := ParseWithOptions(d, &ParseOptions{Strict: true}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParse_StrictLossless(t *testing.T) {
+	d := makeRaw(`{"__metadata__":{"k":"v","a":1},"a":{"dtype":"U8","shape":[1],"data_offsets":[0,1]}}`, 1)
+	if _, err := ParseWithOptions(d, &ParseOptions{Lossless: true}); err != nil {
+		t.Fatal(err)
+	}
+	_, err := ParseWithOptions(d, &ParseOptions{Strict: true, Lossless: true})
+	var he *HeaderError
+	if !errors.As(err, &he) || err.Error() != "invalid header: metadata \"a\": expected string, got 1" {
+		t.Fatalf("%v", err)
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package safetensors
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Summary describes the content of a File.
+type Summary struct {
+	// Parameters is the total number of elements.
+	Parameters uint64
+	// Bytes is the total size of the tensors' data.
+	Bytes uint64
+	// DTypes is the breakdown per dtype.
+	DTypes map[DType]Count
+	// Prefixes is the breakdown per prefix, sorted with runs of digits
+	// compared numerically. The prefix of a tensor name is everything up to
+	// the first dot separated numeric component, e.g. "model.layers.12" for
+	// "model.layers.12.mlp.up_proj.weight", or the name without its last
+	// component when there is none, e.g. "lm_head" for "lm_head.weight".
+	Prefixes []PrefixCount
+	// Largest are the names of the largest tensors, up to 10, largest first.
+	Largest []string
+	// Tied are the groups of tensors with identical dtype, shape and
+	// non-empty data, in header order, like File.Dedup detects them.
+	Tied [][]string
+}
+
+// Count is a number of tensors, parameters and bytes.
+type Count struct {
+	Tensors    int
+	Parameters uint64
+	Bytes      uint64
+}
+
+// PrefixCount is the Count of the tensors sharing a name prefix.
+type PrefixCount struct {
+	Prefix string
+	Count
+}
+
+// Summary returns the statistics of the tensors in f.
+func (f *File) Summary() *Summary {
+	s := &Summary{DTypes: map[DType]Count{}}
+	prefixes := map[string]Count{}
+	for _, t := range f.Tensors {
+		c := Count{Tensors: 1, Parameters: 1, Bytes: uint64(len(t.Data))}
+		for _, v := range t.Shape {
+			c.Parameters *= v
+		}
+		s.Parameters += c.Parameters
+		s.Bytes += c.Bytes
+		s.DTypes[t.DType] = c.add(s.DTypes[t.DType])
+		p := namePrefix(t.Name)
+		prefixes[p] = c.add(prefixes[p])
+	}
+	for _, p := range slices.SortedFunc(maps.Keys(prefixes), compareNatural) {
+		s.Prefixes = append(s.Prefixes, PrefixCount{Prefix: p, Count: prefixes[p]})
+	}
+	order, _ := OrderSize.sortIndexes(f.Tensors)
+	for _, i := range order[:min(len(order), 10)] {
+		s.Largest = append(s.Largest, f.Tensors[i].Name)
+	}
+	sums, _ := f.Hash(context.Background(), nil, sha256.New)
+	type key struct {
+		dtype DType
+		shape string
+		hash  string
+	}
+	groups := map[key]int{}
+	for i, h := range sums {
+		t := &f.Tensors[i]
+		if len(t.Data) == 0 {
+			continue
+		}
+		k := key{t.DType, fmt.Sprint(t.Shape), string(h)}
+		if g, ok := groups[k]; ok {
+			s.Tied[g] = append(s.Tied[g], t.Name)
+		} else {
+			groups[k] = len(s.Tied)
+			s.Tied = append(s.Tied, []string{t.Name})
+		}
+	}
+	s.Tied = slices.DeleteFunc(s.Tied, func(g []string) bool { return len(g) == 1 })
+	if len(s.Tied) == 0 {
+		s.Tied = nil
+	}
+	return s
+}
+
+// String returns a human readable report.
+func (s *Summary) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "parameters: %d\nbytes: %d\n", s.Parameters, s.Bytes)
+	dtypes := slices.SortedFunc(maps.Keys(s.DTypes), func(a, b DType) int { return cmp.Compare(a, b) })
+	for _, dt := range dtypes {
+		c := s.DTypes[dt]
+		fmt.Fprintf(&b, "  %-8s %6d tensors %14d parameters %14d bytes\n", dt, c.Tensors, c.Parameters, c.Bytes)
+	}
+	b.WriteString("prefixes:\n")
+	for _, p := range s.Prefixes {
+		fmt.Fprintf(&b, "  %-40s %6d tensors %14d parameters %14d bytes\n", p.Prefix, p.Tensors, p.Parameters, p.Bytes)
+	}
+	b.WriteString("largest:\n")
+	for _, n := range s.Largest {
+		fmt.Fprintf(&b, "  %s\n", n)
+	}
+	if len(s.Tied) != 0 {
+		b.WriteString("tied:\n")
+		for _, g := range s.Tied {
+			fmt.Fprintf(&b, "  %s\n", strings.Join(g, " = "))
+		}
+	}
+	return b.String()
+}
+
+func (c Count) add(o Count) Count {
+	return Count{Tensors: c.Tensors + o.Tensors, Parameters: c.Parameters + o.Parameters, Bytes: c.Bytes + o.Bytes}
+}
+
+// namePrefix returns the grouping prefix of a tensor name. See
+// Summary.Prefixes.
+func namePrefix(name string) string {
+	parts := strings.Split(name, ".")
+	for i, p := range parts {
+		if p != "" && strings.TrimLeft(p, "0123456789") == "" {
+			return strings.Join(parts[:i+1], ".")
+		}
+	}
+	if len(parts) == 1 {
+		return name
+	}
+	return strings.Join(parts[:len(parts)-1], ".")
+}
@@ -0,0 +1,56 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package safetensors
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFile_Summary(t *testing.T) {
+	emb := make([]byte, 24)
+	emb[0] = 1
+	f := &File{
+		Tensors: []Tensor{
+			{Name: "model.embed_tokens.weight", DType: F32, Shape: []uint64{3, 2}, Data: emb},
+			// Same bytes as model.layers.2.w but not the same dtype or shape.
+			{Name: "model.layers.10.w", DType: F16, Shape: []uint64{2}, Data: make([]byte, 4)},
+			{Name: "model.layers.2.w", DType: BF16, Shape: []uint64{2}, Data: make([]byte, 4)},
+			{Name: "model.layers.2.b", DType: U8, Shape: []uint64{}, Data: []byte{1}},
+			{Name: "lm_head.weight", DType: F32, Shape: []uint64{3, 2}, Data: emb},
+			{Name: "empty", DType: F32, Shape: []uint64{0}, Data: []byte{}},
+			{Name: "model.layers.2.v", DType: BF16, Shape: []uint64{1, 2}, Data: make([]byte, 4)},
+		},
+	}
+	want := &Summary{
+		Parameters: 19,
+		Bytes:      61,
+		DTypes: map[DType]Count{
+			F32:  {Tensors: 3, Parameters: 12, Bytes: 48},
+			F16:  {Tensors: 1, Parameters: 2, Bytes: 4},
+			BF16: {Tensors: 2, Parameters: 4, Bytes: 8},
+			U8:   {Tensors: 1, Parameters: 1, Bytes: 1},
+		},
+		Prefixes: []PrefixCount{
+			{"empty", Count{1, 0, 0}},
+			{"lm_head", Count{1, 6, 24}},
+			{"model.embed_tokens", Count{1, 6, 24}},
+			{"model.layers.2", Count{3, 5, 9}},
+			{"model.layers.10", Count{1, 2, 4}},
+		},
+		Largest: []string{"model.embed_tokens.weight", "lm_head.weight", "model.layers.10.w", "model.layers.2.w", "model.layers.2.v", "model.layers.2.b", "empty"},
+		Tied: [][]string{
+			{"model.embed_tokens.weight", "lm_head.weight"},
+		},
+	}
+	got := f.Summary()
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("(-want,+got)\n%s", diff)
+	}
+	if s := got.String(); s == "" {
+		t.Fatal("empty report")
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package safetensors
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// WriteFileOptions controls how WriteFile writes a file.
+type WriteFileOptions struct {
+	SerializeOptions
+	// Perm is the permission of the file. Defaults to 0o644.
+	Perm os.FileMode
+	// SyncDir also syncs the parent directory after the rename so the new
+	// directory entry is durable. It is ignored on Windows.
+	SyncDir bool
+}
+
+// WriteFile atomically writes f to the named file.
+//
+// The data is written to a temporary file in the same directory, synced to
+// disk and then renamed over name. On failure, name is left untouched and the
+// temporary file is deleted, so readers never observe a partially written
+// file.
+func WriteFile(name string, f *File, opts *WriteFileOptions) error {
+	return WriteFileContext(context.Background(), name, f, opts)
+}
+
+// WriteFileContext is WriteFile with cancellation.
+func WriteFileContext(ctx context.Context, name string, f *File, opts *WriteFileOptions) error {
+	if opts == nil {
+		opts = &WriteFileOptions{}
+	}
+	return writeAtomic(name, opts, func(w *os.File) error {
+		return f.SerializeContext(ctx, w, &opts.SerializeOptions)
+	})
+}
+
+// writeAtomic calls fn to fill a temporary file that is then renamed to name.
+func writeAtomic(name string, opts *WriteFileOptions, fn func(w *os.File) error) error {
+	perm := opts.Perm
+	if perm == 0 {
+		perm = 0o644
+	}
+	dir := filepath.Dir(name)
+	w, err := os.CreateTemp(dir, "."+filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	err = fn(w)
+	if err == nil {
+		err = w.Chmod(perm)
+	}
+	if err == nil {
+		err = w.Sync()
+	}
+	if err2 := w.Close(); err == nil {
+		err = err2
+	}
+	if err == nil {
+		err = os.Rename(w.Name(), name)
+	}
+	if err != nil {
+		_ = os.Remove(w.Name())
+		return err
+	}
+	if opts.SyncDir {
+		return syncDir(dir)
+	}
+	return nil
+}
+
+// syncDir syncs a directory so that a rename within it is durable.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if err2 := d.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
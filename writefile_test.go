@@ -0,0 +1,62 @@
+// Copyright 2024 Marc-Antoine Ruel. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package safetensors
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	n := filepath.Join(dir, "model.safetensors")
+	want := makeTestFile(4)
+	if err := WriteFile(n, want, &WriteFileOptions{SyncDir: true, Perm: 0o600}); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0o600 && os.PathSeparator == '/' {
+		t.Fatal(fi.Mode())
+	}
+	m := Mapped{}
+	if err := m.Open(n); err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	if diff := cmp.Diff(want, m.File); diff != "" {
+		t.Fatalf("(-want,+got)\n%s", diff)
+	}
+}
+
+func TestWriteFile_Error(t *testing.T) {
+	dir := t.TempDir()
+	n := filepath.Join(dir, "model.safetensors")
+	if err := os.WriteFile(n, []byte("old"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := WriteFileContext(ctx, n, makeTestFile(2), nil); !errors.Is(err, context.Canceled) {
+		t.Fatal(err)
+	}
+	bad := &File{Tensors: []Tensor{{Name: "a", DType: F32, Shape: []uint64{2}, Data: []byte{1}}}}
+	if err := WriteFile(n, bad, nil); err == nil {
+		t.Fatal("expected error")
+	}
+	if d, err := os.ReadFile(n); err != nil || string(d) != "old" {
+		t.Fatal(string(d), err)
+	}
+	if e, err := os.ReadDir(dir); err != nil || len(e) != 1 {
+		t.Fatal(e, err)
+	}
+}